@@ -1,3 +1,6 @@
 #!/usr/bin/env bash
 
-go test -fuzz=Fuzz ./pkg/dcc
\ No newline at end of file
+# Go only fuzzes one target at a time, so give each of them FUZZTIME
+for target in FuzzMessage FuzzBitDecoder; do
+	go test -run='^$' -fuzz="^${target}\$" -fuzztime="${FUZZTIME:-1m}" ./pkg/dcc || exit 1
+done
@@ -52,13 +52,16 @@ func main() {
 		panic(err.Error())
 	}
 
-	// Register available outputs
+	// Register available outputs along with their lighting effects
 	for _, output := range outputs {
 		if _, ok := hw.PinOk(output); ok {
+			hw.InitLight(cvHandler, output, dcc.IndexFromOutput(output))
 			d.RegisterOutput(output, hw.GetOutputCallback(output))
+			d.RegisterEffect(output, hw.GetEffectCallback(output))
 		}
 	}
 
+	go hw.RunLighting()
 	go m.Run()
 	go m.RunEMF()
 	d.Monitor()
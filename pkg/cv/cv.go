@@ -16,6 +16,7 @@ type Handler interface {
 	SetSync(uint16, uint8) bool
 	IndexedSet(uint16, uint16, uint8) bool
 	IndexedSetSync(uint16, uint16, uint8) bool
+	PageSet(uint16, uint16, uint8) bool
 	Reset(uint16) bool
 	ResetAll()
 	ProcessChanges()
@@ -52,16 +53,9 @@ func NewCVHandler(version []uint8) *CVHandler {
 	}
 	*/
 
-	// TODO: Handle CVs > 256 properly. Treating CVs as if the index is separate
-	// makes handling callback functions a big problem. Also, defaults get kinda
-	// wonky. Need to refactor for that change if/when CVs > 256 are implemented
-
-	// Load the last-used index from flash
-	cv31, _ := s.IndexedCV(0, 31)
-	cv32, _ := s.IndexedCV(0, 32)
-	err := c.LoadIndex(cv31, cv32)
-	if err != nil {
-		println("could not load index: " + err.Error())
+	// CV31/32 are volatile so we always start on index page 0
+	if err := c.loadDefaults(); err != nil {
+		println("could not load CVs: " + err.Error())
 	}
 
 	return c
@@ -143,16 +137,37 @@ func (c *CVHandler) SetSync(cvNumber uint16, value uint8) bool {
 // TODO: Cleanup - Set vs. Persist isn't really necessary
 // IndexedSet sets a CV value given a paging index and allows it to be written to flash in batches
 func (c *CVHandler) IndexedSet(index, cvNumber uint16, value uint8) bool {
+	if index != c.IndexPage() {
+		// Don't allow changing the index page implicitly
+		fmt.Printf("CV index %d does not match current index %d\r\n", index, c.IndexPage())
+		return false
+	}
+	return c.PageSet(index, cvNumber, value)
+}
+
+// PageSet sets a CV value in an index page whether or not CV31/32 currently select it, for XPOM which carries its
+// own index page, and allows it to be written to flash in batches
+func (c *CVHandler) PageSet(index, cvNumber uint16, value uint8) bool {
 	// Ignore indexes beyond those we support
 	if index > maxCVIndexPage {
 		fmt.Printf("CV index %d is out of range, max is %d\r\n", index, maxCVIndexPage)
 		return false
 	}
 
-	if index != c.IndexPage() {
-		// Don't allow changing the index page implicitly
-		fmt.Printf("CV index %d does not match current index %d\r\n", index, c.IndexPage())
-		return false
+	if cvNumber == 8 {
+		// CV8 is read-only, writing it resets the decoder instead
+		return c.resetFromCV8(value)
+	}
+
+	if cvNumber == 31 || cvNumber == 32 {
+		// Selecting an index page goes through LoadIndex, which rejects the pages we don't have
+		cv31, cv32 := c.CV(31), c.CV(32)
+		if cvNumber == 31 {
+			cv31 = value
+		} else {
+			cv32 = value
+		}
+		return c.LoadIndex(cv31, cv32) == nil
 	}
 
 	// Check if the CV exists. Unset CVs are not allowed to be set
@@ -181,7 +196,7 @@ func (c *CVHandler) IndexedSet(index, cvNumber uint16, value uint8) bool {
 			return false
 		}
 	}
-	return c.cvStore.Set(cvNumber, value)
+	return c.cvStore.IndexedSet(index, cvNumber, value)
 }
 
 // IndexedSetSync sets a CV given a paging index and does not return until it is persisted to flash
@@ -189,6 +204,14 @@ func (c *CVHandler) IndexedSetSync(index, cvNumber uint16, value uint8) bool {
 	if !c.IndexedSet(index, cvNumber, value) {
 		return false
 	}
+	if cvNumber == 8 {
+		// Persist everything the reset changed
+		return c.cvStore.ProcessChanges()
+	}
+	if cvNumber == 31 || cvNumber == 32 {
+		// The index page is volatile
+		return true
+	}
 	return c.cvStore.IndexedPersist(index, cvNumber, value)
 }
 
@@ -197,11 +220,21 @@ func (c *CVHandler) Reset(cvNumber uint16) bool {
 		// Don't allow resetting of CV31/32 directly, only allow through Config Variable Access commands
 		return true
 	}
-	return c.cvStore.Reset(cvNumber)
+	if !c.cvStore.Reset(cvNumber) {
+		return false
+	}
+	c.runCallbacks(cvNumber)
+	return true
 }
 
+// ResetAll resets every CV to its default value, refreshing everything cached by the callbacks
 func (c *CVHandler) ResetAll() {
 	c.cvStore.ResetAll()
+	// CV31/32 are back to their defaults, so follow them back to the index page they select
+	c.cvStore.SetIndex(c.IndexPage())
+	for cvNumber := range c.cvCallbacks {
+		c.runCallbacks(cvNumber)
+	}
 }
 
 func (c *CVHandler) ProcessChanges() {
@@ -43,11 +43,18 @@ func (m *MockHandler) IndexedCVOk(index uint16, cv uint16) (uint8, bool) {
 }
 
 func (m *MockHandler) IndexedSet(index uint16, cv uint16, value uint8) bool {
+	if m.returnValue {
+		m.SetCV(cv, value)
+	}
 	return m.returnValue
 }
 
 func (m *MockHandler) IndexedSetSync(index uint16, cv uint16, value uint8) bool {
-	return m.returnValue
+	return m.IndexedSet(index, cv, value)
+}
+
+func (m *MockHandler) PageSet(index uint16, cv uint16, value uint8) bool {
+	return m.IndexedSet(index, cv, value)
 }
 
 func (m *MockHandler) Reset(cv uint16) bool {
@@ -61,11 +68,15 @@ func (m *MockHandler) ProcessChanges() {
 }
 
 func (m *MockHandler) Set(cv uint16, value uint8) bool {
+	// Like CVHandler, Set doesn't run callbacks
+	if m.returnValue {
+		m.store[cv] = value
+	}
 	return m.returnValue
 }
 
 func (m *MockHandler) SetSync(cv uint16, value uint8) bool {
-	return m.returnValue
+	return m.Set(cv, value)
 }
 
 func (m *MockHandler) RegisterCallback(cv uint16, fn shared.CVCallbackFunc) {
@@ -0,0 +1,140 @@
+package cv
+
+import "testing"
+
+func TestResetFromCV8(t *testing.T) {
+	c := NewCVHandler([]uint8{1, 2, 3})
+
+	callbacks := make(map[uint16]uint8)
+	for _, cvNumber := range []uint16{1, 3, 33} {
+		c.RegisterCallback(cvNumber, func(cvNumber uint16, value uint8) bool {
+			callbacks[cvNumber] = value
+			return true
+		})
+	}
+
+	set := func(cvNumber uint16, value uint8) {
+		t.Helper()
+		if !c.IndexedSetSync(0, cvNumber, value) {
+			t.Fatalf("could not set CV%d", cvNumber)
+		}
+	}
+	set(1, 10)
+	set(3, 50)
+	set(33, 0)
+
+	t.Run("Unknown value", func(t *testing.T) {
+		if c.IndexedSetSync(0, 8, 42) {
+			t.Errorf("CV8 write of 42 was accepted")
+		}
+		if c.CV(8) != 0x0D {
+			t.Errorf("CV8 = %d, want 13", c.CV(8))
+		}
+	})
+
+	t.Run("Motor group", func(t *testing.T) {
+		if !c.IndexedSetSync(0, 8, ResetMotor) {
+			t.Fatalf("motor reset not accepted")
+		}
+		if c.CV(3) != 0 || callbacks[3] != 0 {
+			t.Errorf("CV3 = %d, callback saw %d, want 0", c.CV(3), callbacks[3])
+		}
+		if c.CV(1) != 10 || c.CV(33) != 0 {
+			t.Errorf("CV1 = %d, CV33 = %d, want them untouched", c.CV(1), c.CV(33))
+		}
+	})
+
+	t.Run("Addresses group", func(t *testing.T) {
+		// Long address, RailCom and 28 speed steps
+		set(29, 0b00101010)
+		if !c.IndexedSetSync(0, 8, ResetAddresses) {
+			t.Fatalf("address reset not accepted")
+		}
+		if c.CV(1) != 3 || callbacks[1] != 3 {
+			t.Errorf("CV1 = %d, callback saw %d, want 3", c.CV(1), callbacks[1])
+		}
+		if c.CV(29) != 0b00001010 {
+			t.Errorf("CV29 = %08b, want only the long address bit cleared", c.CV(29))
+		}
+	})
+
+	t.Run("Everything", func(t *testing.T) {
+		if !c.IndexedSetSync(0, 8, ResetEverything) {
+			t.Fatalf("factory reset not accepted")
+		}
+		if c.CV(1) != 3 || callbacks[1] != 3 {
+			t.Errorf("CV1 = %d, callback saw %d, want 3", c.CV(1), callbacks[1])
+		}
+		if c.CV(33) != 1 || callbacks[33] != 1 {
+			t.Errorf("CV33 = %d, callback saw %d, want 1", c.CV(33), callbacks[33])
+		}
+		if c.CV(8) != 0x0D {
+			t.Errorf("CV8 = %d, want 13", c.CV(8))
+		}
+	})
+}
+
+func TestIndexPages(t *testing.T) {
+	c := NewCVHandler([]uint8{1, 2, 3})
+
+	if _, ok := c.CVOk(257); ok {
+		t.Errorf("CV257 readable without an index page")
+	}
+
+	// Select the forward function map page with CV31/32
+	if !c.IndexedSetSync(0, 31, 16) || c.IndexPage() != FunctionMapForwardPage {
+		t.Fatalf("could not select index page 1, got %d", c.IndexPage())
+	}
+	if !c.IndexedSetSync(1, 257, 0b101) {
+		t.Fatalf("could not set CV257 in index page 1")
+	}
+	if c.CV(29) != 0b10 {
+		t.Errorf("CV29 = %d with index page 1 selected, want 2", c.CV(29))
+	}
+
+	if !c.IndexedSetSync(1, 32, 1) || c.IndexPage() != FunctionMapReversePage {
+		t.Fatalf("could not select index page 2, got %d", c.IndexPage())
+	}
+	if c.CV(257) != 0 {
+		t.Errorf("CV257 = %d in index page 2, want 0", c.CV(257))
+	}
+	if c.IndexedCV(FunctionMapForwardPage, 257) != 0b101 {
+		t.Errorf("CV257 = %d in index page 1, want 5", c.IndexedCV(FunctionMapForwardPage, 257))
+	}
+
+	if c.IndexedSetSync(2, 32, maxCVIndexPage) || c.IndexPage() != FunctionMapReversePage {
+		t.Errorf("index page %d was selected", maxCVIndexPage+1)
+	}
+
+	// Only PageSet writes a page other than the selected one
+	if c.IndexedSet(FunctionMapForwardPage, 258, 1) {
+		t.Errorf("IndexedSet wrote index page 1 with index page 2 selected")
+	}
+	if !c.PageSet(FunctionMapForwardPage, 258, 1) || c.IndexedCV(FunctionMapForwardPage, 258) != 1 {
+		t.Errorf("PageSet could not write index page 1 with index page 2 selected")
+	}
+
+	t.Run("Function mapping reset", func(t *testing.T) {
+		if !c.IndexedSetSync(2, 8, ResetFunctionMapping) {
+			t.Fatalf("function mapping reset not accepted")
+		}
+		if c.IndexedCV(FunctionMapForwardPage, 257) != 0 {
+			t.Errorf("CV257 = %d in index page 1 after reset, want 0", c.IndexedCV(FunctionMapForwardPage, 257))
+		}
+	})
+
+	t.Run("Factory reset", func(t *testing.T) {
+		if !c.IndexedSetSync(c.IndexPage(), 8, ResetEverything) {
+			t.Fatalf("factory reset not accepted")
+		}
+		if c.IndexPage() != 0 {
+			t.Errorf("index page %d after factory reset, want 0", c.IndexPage())
+		}
+		if c.Set(257, 1) {
+			t.Errorf("CV257 writable after factory reset returned to index page 0")
+		}
+		if _, ok := c.CVOk(257); ok {
+			t.Errorf("CV257 readable after factory reset returned to index page 0")
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package cv
+
+// Values written to CV8 to reset the decoder. Writing 8 is the usual factory reset, the others reset one group
+const (
+	ResetAddresses       = 1
+	ResetMotor           = 2
+	ResetFunctionMapping = 3
+	ResetLighting        = 4
+	ResetSound           = 5
+	ResetEverything      = 8
+)
+
+type cvRange struct {
+	first, last uint16
+}
+
+// resetGroups lists the CVs reset by each group, ranges may cover CVs that aren't defined
+var resetGroups = map[uint8][]cvRange{
+	// The DCC-A session was tied to the assigned address
+	ResetAddresses: {{1, 1}, {17, 20}, {124, 126}},
+	ResetMotor:     {{2, 6}, {9, 10}, {23, 24}, {49, 56}, {65, 95}, {116, 119}, {127, 127}},
+	// Consist function activation follows the function mapping
+	ResetFunctionMapping: {{21, 22}, {33, 46}},
+	ResetLighting:        {{193, 256}},
+	// No sound support, there's nothing to reset
+	ResetSound: {},
+}
+
+// resetBits lists the bits of CVs shared with other settings that are cleared by each group
+var resetBits = map[uint8][]struct {
+	cvNumber uint16
+	mask     uint8
+}{
+	// CV29 bit 5 selects the long address, the rest of CV29 isn't address configuration
+	ResetAddresses: {{29, 0b00100000}},
+}
+
+// resetPages lists the CVs in index pages reset by each group
+var resetPages = map[uint8][]struct {
+	index uint16
+	cvRange
+}{
+	ResetFunctionMapping: {
+		{FunctionMapForwardPage, cvRange{257, 394}},
+		{FunctionMapReversePage, cvRange{257, 394}},
+		{FunctionRulesPage, cvRange{257, 506}},
+	},
+}
+
+// resetFromCV8 handles a write to CV8, returning false for values that aren't a reset
+func (c *CVHandler) resetFromCV8(value uint8) bool {
+	if value == ResetEverything {
+		println("resetting all CVs")
+		c.ResetAll()
+		return true
+	}
+
+	group, ok := resetGroups[value]
+	if !ok {
+		return false
+	}
+	println("resetting CV group", value)
+	for _, r := range group {
+		for cvNumber := r.first; cvNumber <= r.last; cvNumber++ {
+			c.Reset(cvNumber)
+		}
+	}
+	for _, b := range resetBits[value] {
+		c.Set(b.cvNumber, c.CV(b.cvNumber)&^b.mask)
+		c.runCallbacks(b.cvNumber)
+	}
+	for _, p := range resetPages[value] {
+		for cvNumber := p.first; cvNumber <= p.last; cvNumber++ {
+			c.cvStore.IndexedReset(p.index, cvNumber)
+		}
+	}
+	return true
+}
+
+// runCallbacks calls a CV's callbacks with its current value so cached state is refreshed
+func (c *CVHandler) runCallbacks(cvNumber uint16) {
+	value := c.CV(cvNumber)
+	for _, fn := range c.cvCallbacks[cvNumber] {
+		fn(cvNumber, value)
+	}
+}
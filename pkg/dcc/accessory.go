@@ -0,0 +1,136 @@
+package dcc
+
+import "time"
+
+const (
+	// Basic accessory decoders drive four output pairs (e.g. turnout coils)
+	accessoryPairs = 4
+	// Decoder address 511 is the accessory broadcast address
+	accessoryBroadcastAddress = 511
+	// Accessory output pairs are driven by aux1-aux8
+	accessoryFirstOutput = 2
+
+	// Extended accessory decoders drive one signal head per output address
+	signalHeads   = accessoryPairs
+	signalAspects = 8
+	// Signal aspect output maps are stored as LSB/MSB pairs starting from CV129
+	signalCVBase = 129
+)
+
+// updateAccessoryConfig recalculates the accessory decoder mode and address range from CV1, CV9 and CV29,
+// substituting a value that's in the middle of being set
+func (d *Decoder) updateAccessoryConfig(cvNumber uint16, value uint8) {
+	cv := func(n uint16) uint8 {
+		if n == cvNumber {
+			return value
+		}
+		return d.cv.CV(n)
+	}
+
+	cv29 := cv(29)
+	d.accessory = cv29&0b10000000 != 0
+
+	// Only the low 3 bits of CV9 are used for the address MSB
+	msb := int(cv(9) & 0b111)
+	if cv29&0b01000000 != 0 {
+		// Output addressing, CV1/CV9 hold the 11-bit output address of the first pair
+		d.accessoryBase = msb<<8 | int(cv(1))
+	} else {
+		// Decoder addressing, CV1/CV9 hold the 9-bit decoder address covering four output pairs
+		d.accessoryBase = accessoryOutputAddress(msb<<6|int(cv(1)&0b00111111), 0)
+	}
+}
+
+// accessoryOutputAddress converts a decoder address and pair to the output address shown to users (RCN-213)
+func accessoryOutputAddress(decoder, pair int) int {
+	return (decoder-1)*4 + pair + 1
+}
+
+// setAccessoryOutput switches one output of an output pair. Activating an output turns off the other output
+// in the pair and starts its pulse timer if the pair is configured with a pulse duration
+func (d *Decoder) setAccessoryOutput(pair, output uint8, on bool) {
+	i := 2*pair + output
+	index := accessoryFirstOutput + uint16(i)
+
+	d.accessoryOff[i] = time.Time{}
+	if on {
+		d.accessoryOff[i^1] = time.Time{}
+		d.setOutput(accessoryFirstOutput+uint16(i^1), false)
+
+		if pulse := d.accessoryPulse[pair]; pulse > 0 {
+			d.accessoryOff[i] = time.Now().Add(pulse)
+		}
+	}
+	d.setOutput(index, on)
+}
+
+// accessoryTick turns off any accessory outputs whose pulse duration has elapsed
+func (d *Decoder) accessoryTick(now time.Time) {
+	if !d.accessory {
+		return
+	}
+	for i, off := range d.accessoryOff {
+		if !off.IsZero() && !now.Before(off) {
+			d.accessoryOff[i] = time.Time{}
+			d.setOutput(accessoryFirstOutput+uint16(i), false)
+		}
+	}
+}
+
+// updateSignalMap updates the cached output map for a signal aspect from one of its CVs
+func (d *Decoder) updateSignalMap(cvNumber uint16, value uint8) {
+	n := cvNumber - signalCVBase
+	head := n / (signalAspects * 2)
+	prev := d.signalOutputs(head)
+
+	outputs := &d.signalMaps[head][n%(signalAspects*2)/2]
+	if n%2 == 0 {
+		*outputs = *outputs&0xFF00 | uint16(value)
+	} else {
+		*outputs = *outputs&0x00FF | uint16(value)<<8
+	}
+
+	if !d.accessory {
+		return
+	}
+	// Don't leave behind any outputs that are no longer part of the signal head
+	removed := prev &^ d.signalOutputs(head)
+	for i := range uint16(16) {
+		if removed&(1<<i) != 0 {
+			d.setOutput(i, false)
+		}
+	}
+}
+
+// signalOutputs returns every output used by any of a signal head's aspects
+func (d *Decoder) signalOutputs(head uint16) uint16 {
+	var all uint16
+	for _, outputs := range d.signalMaps[head] {
+		all |= outputs
+	}
+	return all
+}
+
+// setSignalAspect switches a signal head's outputs to those mapped to an aspect. Every output used by any of
+// the head's aspects is considered part of the head and turned off if it isn't part of the new aspect
+func (d *Decoder) setSignalAspect(head, aspect uint8) {
+	if aspect >= signalAspects {
+		// Show unsupported aspects as aspect 0, conventionally the most restrictive
+		aspect = 0
+	}
+
+	all := d.signalOutputs(uint16(head))
+	on := d.signalMaps[head][aspect]
+
+	// Turn the old aspect off before turning the new one on
+	for i := range uint16(16) {
+		if all&^on&(1<<i) != 0 {
+			d.setOutput(i, false)
+		}
+	}
+	for i := range uint16(16) {
+		if on&(1<<i) != 0 {
+			d.setOutput(i, true)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package dcc
+
+import (
+	"testing"
+	"time"
+)
+
+// testAccessoryPacket builds a basic accessory packet for a decoder address, pair and output
+func testAccessoryPacket(decoder uint16, pair, output uint8, activate bool) []byte {
+	b1 := 0x80 | byte(^decoder>>6&0b111)<<4 | pair<<1 | output
+	if activate {
+		b1 |= 0b1000
+	}
+	return withChecksum(0x80|byte(decoder&0b00111111), b1)
+}
+
+func newTestAccessory(t *testing.T, cvs map[uint16]uint8) (*Decoder, *Message, map[uint16]bool) {
+	t.Helper()
+	d, _ := newTestDecoder(t, cvs)
+
+	outputs := make(map[uint16]bool)
+	for _, output := range []string{"aux1", "aux2", "aux3", "aux4", "aux5", "aux6", "aux7", "aux8"} {
+		d.RegisterOutput(output, func(index uint16, on bool) {
+			outputs[index] = on
+		})
+	}
+	return d, NewMessage(d.cv, d), outputs
+}
+
+func processPackets(msg *Message, packets ...[]byte) {
+	for _, p := range packets {
+		msg.AddBytes(p)
+		msg.Process()
+		msg.Reset()
+	}
+}
+
+func TestAccessoryAddressing(t *testing.T) {
+	tests := []struct {
+		name     string
+		cvs      map[uint16]uint8
+		packet   []byte
+		expectOn uint16
+	}{
+		{
+			name:     "Decoder address first pair",
+			cvs:      map[uint16]uint8{1: 1, 9: 40, 29: 0b10000000},
+			packet:   testAccessoryPacket(1, 0, 1, true),
+			expectOn: 3, // aux2
+		},
+		{
+			name:     "Decoder address last pair",
+			cvs:      map[uint16]uint8{1: 1, 9: 40, 29: 0b10000000},
+			packet:   testAccessoryPacket(1, 3, 0, true),
+			expectOn: 8, // aux7
+		},
+		{
+			name:     "Decoder address with CV9 MSB",
+			cvs:      map[uint16]uint8{1: 2, 9: 1, 29: 0b10000000},
+			packet:   testAccessoryPacket(66, 1, 0, true),
+			expectOn: 4, // aux3
+		},
+		{
+			name:     "Different decoder address",
+			cvs:      map[uint16]uint8{1: 1, 9: 40, 29: 0b10000000},
+			packet:   testAccessoryPacket(2, 0, 0, true),
+			expectOn: 0,
+		},
+		{
+			name:     "Output address in range",
+			cvs:      map[uint16]uint8{1: 7, 9: 0, 29: 0b11000000},
+			packet:   testAccessoryPacket(3, 0, 0, true), // Output address 9
+			expectOn: 6,                                  // aux5, third pair
+		},
+		{
+			name:     "Output address out of range",
+			cvs:      map[uint16]uint8{1: 7, 9: 0, 29: 0b11000000},
+			packet:   testAccessoryPacket(3, 3, 0, true), // Output address 12
+			expectOn: 0,
+		},
+		{
+			name:     "Broadcast",
+			cvs:      map[uint16]uint8{1: 1, 9: 40, 29: 0b10000000},
+			packet:   testAccessoryPacket(accessoryBroadcastAddress, 2, 1, true),
+			expectOn: 7, // aux6
+		},
+		{
+			name:     "Multi-function decoder ignores accessory packets",
+			cvs:      map[uint16]uint8{1: 1, 9: 40, 29: 0b00000010},
+			packet:   testAccessoryPacket(1, 0, 0, true),
+			expectOn: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, msg, outputs := newTestAccessory(t, tt.cvs)
+			processPackets(msg, tt.packet)
+
+			for index, on := range outputs {
+				if on && index != tt.expectOn {
+					t.Errorf("output %d on, want %d", index, tt.expectOn)
+				}
+			}
+			if tt.expectOn != 0 && !outputs[tt.expectOn] {
+				t.Errorf("output %d off, want on", tt.expectOn)
+			}
+		})
+	}
+}
+
+func TestAccessoryOutputPairs(t *testing.T) {
+	d, msg, outputs := newTestAccessory(t, map[uint16]uint8{1: 1, 9: 40, 29: 0b10000000, 120: 10, 121: 0})
+
+	// Throw pair 1 one way then the other, only one coil may be energized at a time
+	processPackets(msg, testAccessoryPacket(1, 0, 0, true))
+	if !outputs[2] || outputs[3] {
+		t.Fatalf("pair 1 outputs = %t/%t, want true/false", outputs[2], outputs[3])
+	}
+	processPackets(msg, testAccessoryPacket(1, 0, 1, true))
+	if outputs[2] || !outputs[3] {
+		t.Fatalf("pair 1 outputs = %t/%t, want false/true", outputs[2], outputs[3])
+	}
+
+	// Pair 2 has a continuous output
+	processPackets(msg, testAccessoryPacket(1, 1, 0, true))
+
+	d.tick(time.Now().Add(50 * time.Millisecond))
+	if !outputs[3] {
+		t.Errorf("pair 1 output turned off before its 100ms pulse elapsed")
+	}
+	d.tick(time.Now().Add(150 * time.Millisecond))
+	if outputs[3] {
+		t.Errorf("pair 1 output still on after its 100ms pulse")
+	}
+	if !outputs[4] {
+		t.Errorf("continuous pair 2 output turned off")
+	}
+
+	// Deactivate packets turn off continuous outputs
+	processPackets(msg, testAccessoryPacket(1, 1, 0, false))
+	if outputs[4] {
+		t.Errorf("pair 2 output still on after deactivate packet")
+	}
+
+	// Multi-function packets aren't addressed to accessory decoders
+	msg.AddBytes(withChecksum(0x01, 0x90))
+	if msg.checkAddress() {
+		t.Errorf("accessory decoder accepted a multi-function address")
+	}
+	msg.Reset()
+}
+
+func TestAccessoryOpsModeProgramming(t *testing.T) {
+	d, msg, _ := newTestAccessory(t, map[uint16]uint8{1: 1, 9: 40, 29: 0b10000000, 121: 10})
+
+	// Decoder 1 whole-decoder programming, write 25 to CV121
+	write := withChecksum(0x81, 0xF0, 0xEC, 120, 25)
+	processPackets(msg, write)
+	if got := d.cv.CV(121); got != 10 {
+		t.Fatalf("CV121 = %d after a single write packet, want 10", got)
+	}
+	processPackets(msg, write)
+	if got := d.cv.CV(121); got != 25 {
+		t.Errorf("CV121 = %d, want 25", got)
+	}
+	if d.accessoryPulse[1] != 250*time.Millisecond {
+		t.Errorf("pair 2 pulse = %s, want 250ms", d.accessoryPulse[1])
+	}
+
+	// Other decoders' CVs are left alone
+	other := withChecksum(0x82, 0xF0, 0xEC, 120, 50)
+	processPackets(msg, other, other)
+	if got := d.cv.CV(121); got != 25 {
+		t.Errorf("CV121 = %d after a write to another decoder, want 25", got)
+	}
+}
+
+// testSignalPacket builds an extended accessory packet setting a signal head's aspect
+func testSignalPacket(decoder uint16, head, aspect uint8) []byte {
+	return withChecksum(0x80|byte(decoder&0b00111111), byte(^decoder>>6&0b111)<<4|head<<1|1, aspect)
+}
+
+func TestSignalAspects(t *testing.T) {
+	// Head 1: red aux1, yellow aux2, green aux3. Head 2: red aux4, green aux5 + aux6
+	cvs := map[uint16]uint8{
+		1: 1, 9: 40, 29: 0b10000000,
+		129: 0b00000100, 131: 0b00001000, 133: 0b00010000,
+		145: 0b00100000, 147: 0b11000000,
+	}
+	d, msg, outputs := newTestAccessory(t, cvs)
+	d.RegisterOutput("lampFront", func(index uint16, on bool) {
+		outputs[index] = on
+	})
+
+	expect := func(on ...uint16) {
+		t.Helper()
+		want := make(map[uint16]bool)
+		for _, i := range on {
+			want[i] = true
+		}
+		for i := range uint16(10) {
+			if outputs[i] != want[i] {
+				t.Errorf("output %d = %t, want %t", i, outputs[i], want[i])
+			}
+		}
+	}
+
+	processPackets(msg, testSignalPacket(1, 0, 2))
+	expect(4)
+	processPackets(msg, testSignalPacket(1, 0, 1))
+	expect(3)
+	processPackets(msg, testSignalPacket(1, 1, 1))
+	expect(3, 6, 7)
+	processPackets(msg, testSignalPacket(1, 1, 0))
+	expect(3, 5)
+
+	// Unconfigured aspects are shown as aspect 0
+	processPackets(msg, testSignalPacket(1, 0, 31))
+	expect(2, 5)
+
+	// Other decoders' signals are ignored
+	processPackets(msg, testSignalPacket(2, 0, 2))
+	expect(2, 5)
+
+	// Broadcasts set all heads
+	processPackets(msg, testSignalPacket(1, 0, 2), testSignalPacket(1, 1, 1))
+	expect(4, 6, 7)
+	processPackets(msg, testSignalPacket(accessoryBroadcastAddress, 3, 0))
+	expect(2, 5)
+
+	// Aspect maps can be changed in ops mode, move head 1 aspect 0 from aux1 to lampFront
+	write := withChecksum(0x81, 0x71, 0xEC, 128, 0b00000001)
+	processPackets(msg, write, write)
+	if got := d.cv.CV(129); got != 0b00000001 {
+		t.Fatalf("CV129 = %08b, want 00000001", got)
+	}
+	if outputs[2] {
+		t.Errorf("aux1 still on after being removed from head 1")
+	}
+	processPackets(msg, testSignalPacket(1, 0, 1), testSignalPacket(1, 0, 0))
+	if !outputs[0] || outputs[2] || outputs[3] {
+		t.Errorf("lampFront/aux1/aux2 = %t/%t/%t after remapping aspect 0, want true/false/false",
+			outputs[0], outputs[2], outputs[3])
+	}
+}
@@ -0,0 +1,30 @@
+package dcc
+
+// Analog function group channels (RCN-212), the rest of the 0-255 range is reserved
+const (
+	AnalogVolume        uint8 = 0x01
+	AnalogPositionFirst uint8 = 0x10
+	AnalogPositionLast  uint8 = 0x1F
+)
+
+type AnalogCallback func(channel uint8, value uint8)
+
+// AnalogValue returns the last value received for an analog function channel
+func (d *Decoder) AnalogValue(channel uint8) uint8 {
+	return d.analogValues[channel]
+}
+
+// RegisterAnalog calls fn whenever a value is received for an analog function channel
+func (d *Decoder) RegisterAnalog(channel uint8, fn AnalogCallback) {
+	if d.analogCallbacks == nil {
+		d.analogCallbacks = make(map[uint8][]AnalogCallback)
+	}
+	d.analogCallbacks[channel] = append(d.analogCallbacks[channel], fn)
+}
+
+func (d *Decoder) setAnalog(channel, value uint8) {
+	d.analogValues[channel] = value
+	for _, fn := range d.analogCallbacks[channel] {
+		fn(channel, value)
+	}
+}
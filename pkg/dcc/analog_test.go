@@ -0,0 +1,50 @@
+package dcc
+
+import (
+	"testing"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/motor"
+)
+
+func TestAnalogFunctionGroup(t *testing.T) {
+	d := &Decoder{address: []byte{3}, motor: &motor.Motor{}, outputCallbacks: make(map[uint16][]shared.OutputCallback)}
+	msg := &Message{decoder: d}
+
+	changes := make(map[uint8]uint8)
+	for _, channel := range []uint8{AnalogVolume, AnalogPositionFirst} {
+		d.RegisterAnalog(channel, func(channel uint8, value uint8) {
+			changes[channel] = value
+		})
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		channel uint8
+		expect  uint8
+	}{
+		{name: "Volume", input: []byte{0x3D, AnalogVolume, 0x80}, channel: AnalogVolume, expect: 0x80},
+		{name: "Volume off", input: []byte{0x3D, AnalogVolume, 0x00}, channel: AnalogVolume, expect: 0x00},
+		{name: "Position", input: []byte{0x3D, AnalogPositionFirst, 0xFF}, channel: AnalogPositionFirst, expect: 0xFF},
+		{name: "Unsubscribed channel", input: []byte{0x3D, 0x42, 0x10}, channel: 0x42, expect: 0x10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !msg.advancedOperationInstruction(tt.input) {
+				t.Fatalf("instruction not accepted")
+			}
+			if got := d.AnalogValue(tt.channel); got != tt.expect {
+				t.Errorf("AnalogValue(%d) = %d, want %d", tt.channel, got, tt.expect)
+			}
+			if value, ok := changes[tt.channel]; ok && value != tt.expect {
+				t.Errorf("callback value = %d, want %d", value, tt.expect)
+			}
+		})
+	}
+
+	if _, ok := changes[0x42]; ok {
+		t.Errorf("callback called for unsubscribed channel")
+	}
+}
@@ -0,0 +1,71 @@
+package dcc
+
+// Binary states 1-32767 (RCN-212), state 0 addresses all states at once
+const maxBinaryState = 32767
+
+type BinaryStateCallback func(state uint16, on bool)
+
+// BinaryState returns the last value received for a binary state
+func (d *Decoder) BinaryState(state uint16) bool {
+	if state == 0 || state > maxBinaryState {
+		return false
+	}
+	return d.binaryStates[state/32]&(1<<(state%32)) != 0
+}
+
+// RegisterBinaryState calls fn whenever a binary state is changed
+func (d *Decoder) RegisterBinaryState(state uint16, fn BinaryStateCallback) {
+	if d.binaryStateCallbacks == nil {
+		d.binaryStateCallbacks = make(map[uint16][]BinaryStateCallback)
+	}
+	d.binaryStateCallbacks[state] = append(d.binaryStateCallbacks[state], fn)
+}
+
+// MapBinaryState switches an output along with a binary state
+func (d *Decoder) MapBinaryState(state uint16, output string) {
+	index := IndexFromOutput(output)
+	d.RegisterBinaryState(state, func(_ uint16, on bool) {
+		d.setOutput(index, on)
+	})
+}
+
+func (d *Decoder) setBinaryState(state uint16, on bool) {
+	if state > maxBinaryState {
+		return
+	}
+	if state == 0 {
+		d.clearBinaryStates()
+		return
+	}
+
+	if on {
+		d.binaryStates[state/32] |= 1 << (state % 32)
+	} else {
+		d.binaryStates[state/32] &^= 1 << (state % 32)
+	}
+	for _, fn := range d.binaryStateCallbacks[state] {
+		fn(state, on)
+	}
+	// Conditional function rules can depend on binary states
+	d.updateOutputs()
+}
+
+// clearBinaryStates turns off all binary states, notifying any callbacks for states that were on
+func (d *Decoder) clearBinaryStates() {
+	for i, word := range d.binaryStates {
+		if word == 0 {
+			continue
+		}
+		d.binaryStates[i] = 0
+		for bit := range uint16(32) {
+			if word&(1<<bit) == 0 {
+				continue
+			}
+			state := uint16(i)*32 + bit
+			for _, fn := range d.binaryStateCallbacks[state] {
+				fn(state, false)
+			}
+		}
+	}
+	d.updateOutputs()
+}
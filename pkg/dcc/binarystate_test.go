@@ -0,0 +1,103 @@
+package dcc
+
+import (
+	"testing"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/motor"
+)
+
+func TestBinaryStates(t *testing.T) {
+	d := &Decoder{address: []byte{3}, motor: &motor.Motor{}, outputCallbacks: make(map[uint16][]shared.OutputCallback)}
+	msg := &Message{decoder: d}
+
+	changes := make(map[uint16]bool)
+	for _, state := range []uint16{5, 133, 32767} {
+		d.RegisterBinaryState(state, func(state uint16, on bool) {
+			changes[state] = on
+		})
+	}
+
+	tests := []struct {
+		name   string
+		input  []byte
+		state  uint16
+		expect bool
+	}{
+		{
+			name:   "Short form on",
+			input:  []byte{0xDD, 0x85},
+			state:  5,
+			expect: true,
+		},
+		{
+			name:   "Short form off",
+			input:  []byte{0xDD, 0x05},
+			state:  5,
+			expect: false,
+		},
+		{
+			name:   "Long form without high byte",
+			input:  []byte{0xC0, 0x85},
+			state:  5,
+			expect: true,
+		},
+		{
+			name:   "Long form with high byte",
+			input:  []byte{0xC0, 0x85, 0x01},
+			state:  133,
+			expect: true,
+		},
+		{
+			name:   "Long form highest state",
+			input:  []byte{0xC0, 0xFF, 0xFF},
+			state:  32767,
+			expect: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !msg.featureExpansion(tt.input) {
+				t.Fatalf("featureExpansion() = false, want true")
+			}
+			if got := d.BinaryState(tt.state); got != tt.expect {
+				t.Errorf("BinaryState(%d) = %t, want %t", tt.state, got, tt.expect)
+			}
+			if got, ok := changes[tt.state]; !ok || got != tt.expect {
+				t.Errorf("callback for state %d = %t (called: %t), want %t", tt.state, got, ok, tt.expect)
+			}
+		})
+	}
+
+	// State 0 clears everything
+	msg.featureExpansion([]byte{0xDD, 0x00})
+	for _, state := range []uint16{5, 133, 32767} {
+		if d.BinaryState(state) {
+			t.Errorf("BinaryState(%d) still on after clearing all states", state)
+		}
+		if changes[state] {
+			t.Errorf("callback for state %d not notified when clearing all states", state)
+		}
+	}
+}
+
+func TestMapBinaryState(t *testing.T) {
+	d := &Decoder{address: []byte{3}, motor: &motor.Motor{}, outputCallbacks: make(map[uint16][]shared.OutputCallback)}
+	msg := &Message{decoder: d}
+
+	var aux1 bool
+	d.RegisterOutput("aux1", func(index uint16, on bool) {
+		aux1 = on
+	})
+	d.MapBinaryState(200, "aux1")
+
+	msg.featureExpansion([]byte{0xC0, 0x80 | 200&0x7F, 200 >> 7})
+	if !aux1 {
+		t.Errorf("aux1 off after turning on binary state 200")
+	}
+	msg.featureExpansion([]byte{0xC0, 200 & 0x7F, 200 >> 7})
+	if aux1 {
+		t.Errorf("aux1 on after turning off binary state 200")
+	}
+}
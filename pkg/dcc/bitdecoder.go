@@ -0,0 +1,110 @@
+package dcc
+
+// packetError is the reason the bit decoder dropped a packet or a half-wave
+type packetError uint8
+
+const (
+	errShortPreamble packetError = iota // Zero bit before the preamble was long enough
+	errNoise                            // Half-wave outside both the one and zero bit windows
+	errChecksum                         // Error detection byte didn't match
+	errOverlength                       // More than maxMsgLength bytes without a packet end bit
+	numPacketErrors
+)
+
+// bitDecoder turns half-wave durations measured by the PIO into packets. It doesn't touch the hardware so
+// Monitor only has to feed it
+type bitDecoder struct {
+	// Half-wave timing, optionally learning the edge delay from the preamble
+	timing       bitTiming
+	bitTolerance uint32
+	calibrating  bool
+	calibration  edgeCalibration
+
+	state decoderState
+	i     int
+	// Set after a short preamble until the next full one, so a lost packet is only counted once
+	short bool
+	out   byte
+	buf   [maxMsgLength]byte
+	n     int
+
+	// Packets ended with an end bit, valid or not, and how often each error was seen
+	packets uint32
+	errors  [numPacketErrors]uint32
+}
+
+// reset drops any partial packet and waits for the next preamble
+func (b *bitDecoder) reset() {
+	b.state = Preamble
+	b.i = 0
+	b.out = 0
+	b.n = 0
+}
+
+// add decodes one half-wave in microseconds, returning the packet once its end bit is received with a valid
+// checksum. The packet is only valid until the next call
+func (b *bitDecoder) add(ticks uint32) ([]byte, bool) {
+	if b.calibrating && b.state == Preamble {
+		b.calibrate(ticks)
+	}
+
+	bit, ok := b.timing.bit(ticks)
+	if !ok {
+		b.errors[errNoise]++
+		return nil, false
+	}
+
+	// Increment the bit counter
+	b.i++
+
+	switch b.state {
+	case Preamble:
+		// Waiting for the preamble count to be satisfied
+		if bit == 0 {
+			if b.i >= preambleLength {
+				// Preamble terminator bit received, ready to decode data
+				b.state = Bits
+				b.short = false
+			} else if !b.short {
+				// Premature terminating bit, start counting again
+				b.errors[errShortPreamble]++
+				b.short = true
+			}
+			b.i = 0
+		}
+	case Bits:
+		// Shift in the bit, the next bit will be a terminator once the byte is complete
+		b.out = b.out<<1 | byte(bit)
+		if b.i == 8 {
+			if b.n == maxMsgLength {
+				b.errors[errOverlength]++
+				b.reset()
+				return nil, false
+			}
+			b.buf[b.n] = b.out
+			b.n++
+			b.out = 0
+			b.state = Terminator
+		}
+	case Terminator:
+		b.i = 0
+		b.state = Bits
+		if bit == 1 {
+			// End of message terminator bit received, wait for a preamble next
+			packet := b.buf[:b.n]
+			b.packets++
+			b.reset()
+
+			var xor byte
+			for _, v := range packet {
+				xor ^= v
+			}
+			if xor != 0 {
+				b.errors[errChecksum]++
+				return nil, false
+			}
+			return packet, true
+		}
+	}
+	return nil, false
+}
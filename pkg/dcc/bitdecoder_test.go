@@ -0,0 +1,143 @@
+package dcc
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testHalfWaves encodes a packet as the half-wave durations the PIO would measure, with ideal one and zero bits
+func testHalfWaves(preamble int, packet ...byte) []uint32 {
+	const one, zero = 58, 100
+	var waves []uint32
+	for range preamble {
+		waves = append(waves, one)
+	}
+	for _, b := range packet {
+		waves = append(waves, zero)
+		for i := 7; i >= 0; i-- {
+			if b&(1<<i) != 0 {
+				waves = append(waves, one)
+			} else {
+				waves = append(waves, zero)
+			}
+		}
+	}
+	return append(waves, one)
+}
+
+func newTestBitDecoder() *bitDecoder {
+	return &bitDecoder{timing: newBitTiming(0, 0)}
+}
+
+func TestBitDecoder(t *testing.T) {
+	speed := withChecksum(0x03, 0x3F, 0x80|20)
+	idle := withChecksum(0xFF, 0x00)
+
+	tests := []struct {
+		name          string
+		waves         []uint32
+		expectPackets [][]byte
+		expectErrors  [numPacketErrors]uint32
+		expectCount   uint32
+	}{
+		{
+			name:          "Single packet",
+			waves:         testHalfWaves(14, speed...),
+			expectPackets: [][]byte{speed},
+			expectCount:   1,
+		},
+		{
+			name:          "Back to back packets",
+			waves:         append(testHalfWaves(preambleLength, speed...), testHalfWaves(preambleLength, idle...)...),
+			expectPackets: [][]byte{speed, idle},
+			expectCount:   2,
+		},
+		{
+			name:         "Short preamble",
+			waves:        testHalfWaves(5, speed...),
+			expectErrors: [numPacketErrors]uint32{errShortPreamble: 1},
+		},
+		{
+			name:         "Checksum error",
+			waves:        testHalfWaves(14, 0x03, 0x3F, 0x80|20, 0x00),
+			expectErrors: [numPacketErrors]uint32{errChecksum: 1},
+			expectCount:  1,
+		},
+		{
+			name:         "Overlength",
+			waves:        testHalfWaves(14, make([]byte, maxMsgLength+1)...),
+			expectErrors: [numPacketErrors]uint32{errOverlength: 1},
+		},
+		{
+			name: "Noise is skipped",
+			waves: func() []uint32 {
+				w := testHalfWaves(14, speed...)
+				return append(w[:20], append([]uint32{20, 75}, w[20:]...)...)
+			}(),
+			expectPackets: [][]byte{speed},
+			expectErrors:  [numPacketErrors]uint32{errNoise: 2},
+			expectCount:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBitDecoder()
+			var packets [][]byte
+			for _, ticks := range tt.waves {
+				if packet, ok := b.add(ticks); ok {
+					packets = append(packets, bytes.Clone(packet))
+				}
+			}
+
+			if len(packets) != len(tt.expectPackets) {
+				t.Fatalf("got %d packets % x, want %d", len(packets), packets, len(tt.expectPackets))
+			}
+			for i, p := range packets {
+				if !bytes.Equal(p, tt.expectPackets[i]) {
+					t.Errorf("packet %d = % x, want % x", i, p, tt.expectPackets[i])
+				}
+			}
+			if b.errors != tt.expectErrors {
+				t.Errorf("errors = %v, want %v", b.errors, tt.expectErrors)
+			}
+			if b.packets != tt.expectCount {
+				t.Errorf("packet count = %d, want %d", b.packets, tt.expectCount)
+			}
+		})
+	}
+}
+
+func FuzzBitDecoder(f *testing.F) {
+	// Each byte is a half-wave of twice its value in microseconds
+	seed := func(waves []uint32) []byte {
+		b := make([]byte, len(waves))
+		for i, w := range waves {
+			b[i] = byte(w / 2)
+		}
+		return b
+	}
+	f.Add(seed(testHalfWaves(14, withChecksum(0x03, 0x3F, 0x80|20)...)))
+	f.Add(seed(testHalfWaves(preambleLength, withChecksum(0xFF, 0x00)...)))
+	f.Add(seed(testHalfWaves(14, make([]byte, maxMsgLength+1)...)))
+
+	f.Fuzz(func(t *testing.T, waves []byte) {
+		b := newTestBitDecoder()
+		for _, w := range waves {
+			packet, ok := b.add(uint32(w) * 2)
+			if !ok {
+				continue
+			}
+			if len(packet) == 0 || len(packet) > maxMsgLength {
+				t.Fatalf("packet length %d", len(packet))
+			}
+			var xor byte
+			for _, v := range packet {
+				xor ^= v
+			}
+			if xor != 0 {
+				t.Fatalf("packet % x with a bad checksum", packet)
+			}
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package dcc
 
 import (
+	"bytes"
 	"errors"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 )
 
 //go:generate pioasm -o go dcc.pio dcc_pio.go
+//go:generate pioasm -o go railcom.pio railcom_pio.go
 
 type Decoder struct {
 	cv    cv.Handler
@@ -19,37 +21,71 @@ type Decoder struct {
 	motor *motor.Motor
 
 	sm     shared.StateMachine
+	dccPin shared.Pin
 	offset uint8
 	buf    *ringbuffer.RingBuffer[uint32]
+	bits   bitDecoder
+	// When half-waves were last read from the PIO
+	lastWave time.Time
 
-	address            []byte
-	consistAddress     []byte
-	Snoop              bool
-	checksumErrorCount uint32
+	address        []byte
+	consistAddress []byte
+	Snoop          bool
 
-	capPin     shared.Pin
 	outputPins []shared.Pin
-	rcTxPin    shared.Pin
-	rcTxQueued bool
+	rcTx       railcomTx
 
 	opMode           opMode
 	lastSvcResetTime time.Time
 	svcModeReady     bool
+	pageRegister     uint8
 
 	outputCallbacks map[uint16][]shared.OutputCallback
 	outputMapsFwd   map[uint16]uint16
 	outputMapsRev   map[uint16]uint16
 
+	// Function states and the outputs and effects they last switched, after the conditional rules
+	functionStates  [maxFunction/32 + 1]uint32
+	outputStates    uint16
+	outputEffects   [16]uint8
+	effectCallbacks map[uint16][]EffectCallback
+
 	consistFuncMask [3]uint8
+	consistFL       uint8
+
+	accessory      bool
+	accessoryBase  int
+	accessoryPulse [accessoryPairs]time.Duration
+	accessoryOff   [2 * accessoryPairs]time.Time
+	signalMaps     [signalHeads][signalAspects]uint16
+
+	binaryStates         [(maxBinaryState + 1) / 32]uint32
+	binaryStateCallbacks map[uint16][]BinaryStateCallback
+
+	analogValues    [256]uint8
+	analogCallbacks map[uint8][]AnalogCallback
+
+	// Restricted speed step in 28-step notation, only applied while speedRestricted is set
+	speedRestricted bool
+	speedLimit      uint8
+
+	clock ModelClock
+
+	logon    logonState
+	uniqueID uint32
 
 	lastDirection motor.Direction
+	lastMoving    bool
+
+	// Last packet addressed to us, for the CV11 packet timeout
+	lastPacket time.Time
+	timedOut   bool
 }
 
 func NewDecoder(cvHandler cv.Handler, m *motor.Motor, pioNum int, hw *hal.HAL, outputs []shared.Pin) (*Decoder, error) {
 	d := &Decoder{
 		address:         make([]byte, 0, 2),
 		buf:             ringbuffer.NewRingBuffer[uint32](),
-		capPin:          hw.Pin("capCharge"),
 		consistAddress:  make([]byte, 0, 2),
 		cv:              cvHandler,
 		hw:              hw,
@@ -58,13 +94,18 @@ func NewDecoder(cvHandler cv.Handler, m *motor.Motor, pioNum int, hw *hal.HAL, o
 		outputMapsFwd:   make(map[uint16]uint16, 12),
 		outputMapsRev:   make(map[uint16]uint16, 12),
 		outputPins:      outputs,
-		rcTxPin:         hw.Pin("railcom"),
+		pageRegister:    1,
+		uniqueID:        hw.UniqueID(),
 	}
 
 	err := d.initPIO(pioNum, hw.Pin("dcc"))
 	if err != nil {
 		return nil, err
 	}
+	err = d.initRailcom(pioNum, hw.Pin("railcom"))
+	if err != nil {
+		return nil, err
+	}
 
 	d.RegisterCallbacks()
 
@@ -88,6 +129,17 @@ func (d *Decoder) SetAddress(addr uint16) error {
 	return nil
 }
 
+// addressValue returns our current multi-function address and whether it's a long address
+func (d *Decoder) addressValue() (uint16, bool) {
+	switch len(d.address) {
+	case 1:
+		return uint16(d.address[0]), false
+	case 2:
+		return uint16(d.address[0]&0x3F)<<8 | uint16(d.address[1]), true
+	}
+	return 0, false
+}
+
 func (d *Decoder) setAddress(addr uint16) error {
 	if addr == 0 || addr > 10239 {
 		return errors.New("address out of range")
@@ -114,30 +166,53 @@ func (d *Decoder) OpMode() opMode {
 }
 
 func (d *Decoder) SetOpMode(mode opMode) {
-	if mode == ServiceMode {
-		// If we've received a service mode reset packet re-up the 20ms timer
-		d.lastSvcResetTime = time.Now()
-		d.svcModeReady = true
-	} else {
+	switch mode {
+	case ServiceMode:
+		if d.opMode != ServiceMode {
+			println("entering service mode")
+		}
+	case OperationsMode:
+		// Any operations mode packet closes the window for entering service mode
 		d.svcModeReady = false
+		if d.opMode == ServiceMode {
+			println("exiting service mode")
+		}
 	}
 	d.opMode = mode
-	// TODO: Handle exiting service mode
 }
 
+// Reset handles the Digital Decoder Reset packet. Per S-9.2.4, volatile memory (including any speed
+// and direction data) is erased and the decoder returns to its normal power-up state, bringing the
+// locomotive to an immediate stop if it's moving
 func (d *Decoder) Reset() {
+	// A reset packet also opens the window for entering service mode
 	d.lastSvcResetTime = time.Now()
 	d.svcModeReady = true
-	// TODO: Implement reset packet handling
-	/* When a Digital Decoder receives a Digital Decoder Reset Packet, it shall erase all
-	volatile memory (including any speed and direction data), and return to its normal
-	power-up state. If the Digital Decoder is operating a locomotive at a non-zero speed
-	when it receives a Digital Decoder Reset, it shall bring the locomotive to an
-	immediate stop. */
+
+	// Stop immediately and forget the speed, direction and speed mode
+	d.motor.Reset()
+	d.speedRestricted = false
+	d.lastDirection = d.motor.Direction()
+
+	// Turn off all the outputs
+	d.accessoryOff = [2 * accessoryPairs]time.Time{}
+	d.outputsOff()
+}
+
+// outputsOff turns off every registered output, forgetting the function states until they're sent again
+func (d *Decoder) outputsOff() {
+	d.functionStates = [maxFunction/32 + 1]uint32{}
+	d.outputStates = 0
+	for output, handlers := range d.outputCallbacks {
+		for _, fn := range handlers {
+			fn(output, false)
+		}
+	}
 }
 
 func (d *Decoder) RegisterCallbacks() {
 	d.cv.RegisterCallback(1, d.CVCallback())
+	d.cv.RegisterCallback(9, d.CVCallback())
 	for i := uint16(17); i <= 22; i++ {
 		d.cv.RegisterCallback(i, d.CVCallback())
 	}
@@ -145,13 +220,40 @@ func (d *Decoder) RegisterCallbacks() {
 	for i := uint16(33); i <= 46; i++ {
 		d.cv.RegisterCallback(i, d.CVCallback())
 	}
+	d.cv.RegisterCallback(112, d.CVCallback())
 	d.cv.RegisterCallback(113, d.CVCallback())
+	d.cv.RegisterCallback(115, d.CVCallback())
+	for i := uint16(120); i <= 123; i++ {
+		d.cv.RegisterCallback(i, d.CVCallback())
+	}
+	for i := uint16(signalCVBase); i < signalCVBase+signalHeads*signalAspects*2; i++ {
+		d.cv.RegisterCallback(i, d.CVCallback())
+	}
+}
+
+// tick runs the decoder's timed housekeeping, it's called regularly from the Monitor loop
+func (d *Decoder) tick(now time.Time) {
+	d.accessoryTick(now)
+	d.timeoutTick(now)
+	d.rulesTick()
 }
 
 func (d *Decoder) CVCallback() shared.CVCallbackFunc {
 	return func(cvNumber uint16, value uint8) bool {
+		if cvNumber >= signalCVBase && cvNumber < signalCVBase+signalHeads*signalAspects*2 {
+			// Extended accessory signal aspect output maps
+			d.updateSignalMap(cvNumber, value)
+			return true
+		}
+
 		switch cvNumber {
 		case 1:
+			d.updateAccessoryConfig(cvNumber, value)
+			if d.accessory {
+				// Accessory decoders use all of CV1 for output addressing and the low 6 bits for decoder addressing
+				return true
+			}
+
 			// Set the short address
 			// Not allowing 0 because DC mode is out of scope
 			if value < 1 || value > 127 {
@@ -159,6 +261,10 @@ func (d *Decoder) CVCallback() shared.CVCallbackFunc {
 			}
 			d.setAddress(uint16(value))
 
+		case 9:
+			// Accessory address MSB, CV9 is otherwise the motor PWM frequency
+			d.updateAccessoryConfig(cvNumber, value)
+
 		case 17, 18:
 			cv17 := d.cv.CV(17)
 			if cvNumber == 17 {
@@ -167,45 +273,41 @@ func (d *Decoder) CVCallback() shared.CVCallbackFunc {
 			return d.setExtendedAddress(cv17)
 
 		case 19, 20:
-			// Set the consist address bytes
-			// TODO: Add validation around CV19 value in extended address mode when standardized
-			if len(d.address) < int(cvNumber)-18 {
-				d.address = append(d.address, value)
+			cv19, cv20 := d.cv.CV(19), d.cv.CV(20)
+			if cvNumber == 19 {
+				cv19 = value
 			} else {
-				d.address[cvNumber-19] = value
+				cv20 = value
 			}
+			return d.updateConsistAddress(cv19, cv20)
 
 		case 21:
 			// Convert CV21 to a bitmask for enabling the functions via consist address (F1-F8)
-			// Clear the bits for F1-F4
-			mask := d.consistFuncMask[0] & 0b11110000
 			// Set the bits for F1-F4
-			mask |= value & 0b00001111
-			d.consistFuncMask[0] = mask
+			d.consistFuncMask[0] = value & 0b00001111
 
 			// Set the bits for F5-F8
 			d.consistFuncMask[1] = value >> 4
 
 		case 22:
 			// Convert CV22 to a bitmask for enabling the functions via consist address (FLf, FLr, F9-F12)
-			// TODO: Implement this for FLf and FLr separately
-			// Clear the bit for FL (F0)
-			mask := d.consistFuncMask[0] &^ (1 << 4)
-			// Set the bit for FL (F0) (CV bit 0 -> mask bit 4, FLr is CV bit 1)
-			mask |= (value & 1) << 4
-			d.consistFuncMask[0] = mask
+			// FLf (CV bit 0) and FLr (CV bit 1) are resolved against our direction by consistHeadlight
+			d.consistFL = value & 0b11
 
 			// Set the mask bits for F9-F12 (CV bits 2-5)
 			d.consistFuncMask[2] = (value & 0b00111100) >> 2
 
 		case 29:
+			// CV29 bit 7: 0 = mobile decoder, 1 = accessory decoder
+			// CV29 bit 6: 0 = decoder addressing, 1 = output addressing (accessory decoders only)
+			d.updateAccessoryConfig(cvNumber, value)
+
 			// CV29 bit 5: 0 = short address, 1 = extended address
 			if (value & 0b00100000) != 0 {
 				return d.setExtendedAddress(d.cv.CV(17))
 			} else {
-				// Clear bit 5 and use the short address
+				// Bit 5 is clear, use the short address
 				d.address = append(d.address[:0], d.cv.CV(1))
-				return false
 			}
 		case 33:
 			// Configure function mapping to output F0f
@@ -225,17 +327,46 @@ func (d *Decoder) CVCallback() shared.CVCallbackFunc {
 				outputs = outputs << 3
 			}
 			d.outputMapsFwd[outputNum] = outputs
+		case 112:
+			return d.updateBitTiming(value, d.cv.CV(115))
+		case 115:
+			return d.updateBitTiming(d.cv.CV(112), value)
 		case 113:
 			// Set watchdog timeout in 32.768ms steps
 			// Controls when the decoder will reset when running on a keepalive capacitor
 			ms := float32(max(1, value)) * 32.768
 			d.hw.WatchdogSet(time.Duration(ms) * time.Millisecond)
+		case 120, 121, 122, 123:
+			// Accessory output pair pulse duration in 10ms steps, 0 leaves the output on until deactivated
+			d.accessoryPulse[cvNumber-120] = time.Duration(value) * 10 * time.Millisecond
 		}
 
 		return true
 	}
 }
 
+// updateConsistAddress sets the consist address from CV19 bits 0-6 plus 100 times CV20. An address of 0 takes
+// us out of the consist
+func (d *Decoder) updateConsistAddress(cv19, cv20 uint8) bool {
+	addr := uint16(cv20)*100 + uint16(cv19&0x7F)
+	if addr > 10239 {
+		return false
+	}
+
+	d.consistAddress = d.consistAddress[:0]
+	if addr > 127 {
+		d.consistAddress = append(d.consistAddress, 0xC0|byte(addr>>8), byte(addr))
+	} else if addr > 0 {
+		d.consistAddress = append(d.consistAddress, byte(addr))
+	}
+	return true
+}
+
+// inConsist reports whether consist control is in effect with a consist address other than our own
+func (d *Decoder) inConsist() bool {
+	return len(d.consistAddress) > 0 && !bytes.Equal(d.consistAddress, d.address)
+}
+
 func (d *Decoder) setExtendedAddress(cv17 uint8) bool {
 	if cv17 >= 192 && cv17 <= 231 {
 		// If CV17 is 192 and CV18 is 0 the long address would be 0, abort
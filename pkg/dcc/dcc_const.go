@@ -1,5 +1,7 @@
 package dcc
 
+import "time"
+
 const (
 	// 2 MHz PIO clock for easy timing calculations
 	// 2 instructions per counter increment gives the counter in microseconds
@@ -13,6 +15,69 @@ const (
 	tr1MaxTime       = 64
 	tr0MinTime       = 90
 	tr0MaxTime       = 10_000
+	tr1NominalTime   = 58
+
+	// CV112/CV115 DCC input timing
+	maxEdgeDelay        = 40  // Largest edge delay that can be set or learned in microseconds
+	maxBitTolerance     = 12  // Widest tolerance that still leaves a gap between one and zero bits
+	edgeCalibrate       = 254 // CV115 value to learn the edge delay from the preamble
+	edgeFromBoard       = 255 // CV112/CV115 value to use the board profile
+	edgeCalibrationBits = 256 // Preamble half-waves averaged to learn the edge delay
+
+	// RailCom channel windows, measured from the end of the packet end bit (RCN-217)
+	rcChannel1Start = 80 * time.Microsecond
+	rcChannel1End   = 177 * time.Microsecond
+	rcChannel2Start = 193 * time.Microsecond
+	rcChannel2End   = 454 * time.Microsecond
+	// 10 bits of 8 PIO cycles each plus 2 cycles of overhead
+	rcByteTime = 41 * time.Microsecond
+	// PIO cycles an idle UART takes from pulling a word to its start bit, on top of the delay count
+	rcTxOverhead = 10
+	// How long to watch for the cutout after an end bit before giving up on a dead track
+	rcCutoutWait = 200 * time.Microsecond
+	// Monitor polls without sleeping while a packet end bit may be next, as long as the track is live
+	rcSpinLimit = time.Millisecond
+	// Channel 2 datagrams waiting for a packet addressed to us
+	rcQueueSize = 8
+
+	// app:dyn dynamic variable indexes (RCN-217)
+	dynSpeed       = 0  // Actual speed in km/h, 0-255
+	dynSpeedHigh   = 1  // Actual speed in km/h, 256-511 (minus 256)
+	dynQoS         = 7  // Percentage of packets received with errors
+	dynTemperature = 26 // Decoder temperature in degrees Celsius, offset by 50
+
+	// CV114 packet timeout behaviour
+	timeoutCoast      = 0
+	timeoutMomentum   = 1
+	timeoutStop       = 2
+	timeoutActionMask = 0b011
+	timeoutOutputsOff = 0b100
+
+	// Extended function mapping in index pages 1 (forward) and 2 (reverse), two CVs per function from CV257
+	functionMapBase   = 257
+	functionMapEnable = 0x80
+	maxFunction       = 68
+
+	// Conditional function rules in index page 3, ten CVs per rule from CV257
+	ruleBase        = 257
+	ruleSize        = 10
+	maxRules        = 25
+	ruleConditions  = 3
+	ruleActionOn    = 1
+	ruleActionOff   = 2
+	ruleActionMask  = 0b11
+	ruleEffectShift = 4
+
+	// Rule condition types, in bits 4-6 of a condition's first CV
+	conditionUnused      = 0
+	conditionFunction    = 1
+	conditionBinaryState = 2
+	conditionForward     = 3
+	conditionMoving      = 4
+	conditionInvert      = 0x80
+
+	// Non-service mode packets don't end service mode within 20ms of a reset packet (S-9.2.3)
+	svcModeWindow = 20 * time.Millisecond
 )
 
 type decoderState int
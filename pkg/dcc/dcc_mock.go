@@ -9,5 +9,10 @@ func (d *Decoder) initPIO(pioNum int, pin shared.Pin) error {
 	return nil
 }
 
+// initRailcom is a stub for non-RP platforms, tests provide their own UART
+func (d *Decoder) initRailcom(pioNum int, pin shared.Pin) error {
+	return nil
+}
+
 func (d *Decoder) BasicAck() {
 }
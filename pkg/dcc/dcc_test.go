@@ -0,0 +1,94 @@
+package dcc
+
+import (
+	"testing"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/cv"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/hal"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/motor"
+)
+
+// newTestDecoder builds a decoder on the mock HAL with the motor PWM duty captured for inspection
+func newTestDecoder(t *testing.T, cvs map[uint16]uint8) (*Decoder, *float32) {
+	t.Helper()
+	t.Cleanup(func() {
+		hal.PWMInitHook = nil
+		hal.PWMSetDutyHook = nil
+	})
+
+	pinA := shared.MockPin(1)
+	pwmPin := make(map[*hal.SimplePWM]shared.Pin)
+	var dutyA float32
+	hal.PWMInitHook = func(pin shared.Pin, freq uint64, duty float32) (*hal.SimplePWM, error) {
+		p := &hal.SimplePWM{}
+		pwmPin[p] = pin
+		return p, nil
+	}
+	hal.PWMSetDutyHook = func(p *hal.SimplePWM, duty float32) {
+		if pwmPin[p] == pinA {
+			dutyA = duty
+		}
+	}
+
+	mockCV := cv.NewMockHandler(true, cvs)
+	hw := hal.NewHAL()
+	m := motor.NewMotor(mockCV, hw, pinA, shared.MockPin(2), shared.MockPin(3), shared.MockPin(4))
+	d, err := NewDecoder(mockCV, m, 0, hw, nil)
+	if err != nil {
+		t.Fatalf("NewDecoder() error: %v", err)
+	}
+	return d, &dutyA
+}
+
+func TestDecoderReset(t *testing.T) {
+	d, duty := newTestDecoder(t, map[uint16]uint8{1: 3, 29: 0b00000010})
+
+	outputs := make(map[uint16]bool)
+	for _, output := range []string{"lampFront", "lampRear", "aux1"} {
+		d.RegisterOutput(output, func(index uint16, on bool) {
+			outputs[index] = on
+		})
+	}
+	for index := range uint16(3) {
+		outputs[index] = true
+	}
+
+	msg := NewMessage(d.cv, d)
+	msg.cvConfirm[17] = 0xC0
+
+	// Command a speed before the reset packet arrives
+	msg.AddBytes([]byte{0x03, 0x3F, 0x80 | 50, 0x03 ^ 0x3F ^ (0x80 | 50)})
+	msg.Process()
+	msg.Reset()
+
+	// Leave a CV write waiting on its confirmation packet
+	msg.pending = append(msg.pending, 0x03, 0xEC, 0x00, 0x05, 0x03^0xEC^0x05)
+
+	msg.AddBytes([]byte{0x00, 0x00, 0x00})
+	msg.Process()
+
+	if *duty != 0 {
+		t.Errorf("motor duty = %f after reset, want 0", *duty)
+	}
+	if d.motor.Direction() != motor.Forward {
+		t.Errorf("motor direction = %v after reset, want Forward", d.motor.Direction())
+	}
+	if d.motor.SpeedMode() != motor.SpeedMode28 {
+		t.Errorf("speed mode = %d after reset, want %d", d.motor.SpeedMode(), motor.SpeedMode28)
+	}
+	for index, on := range outputs {
+		if on {
+			t.Errorf("output %d still on after reset", index)
+		}
+	}
+	if len(msg.pending) != 0 {
+		t.Errorf("pending CV write not cleared: %v", msg.pending)
+	}
+	if len(msg.cvConfirm) != 0 {
+		t.Errorf("pending CV confirmations not cleared: %v", msg.cvConfirm)
+	}
+	if !d.svcModeReady {
+		t.Errorf("reset packet should open the service mode window")
+	}
+}
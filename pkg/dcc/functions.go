@@ -2,6 +2,7 @@ package dcc
 
 import (
 	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/cv"
 	"github.com/mikesmitty/rp24-dcc-decoder/pkg/motor"
 )
 
@@ -10,50 +11,152 @@ func (d *Decoder) RegisterOutput(output string, fn shared.OutputCallback) {
 	d.outputCallbacks[index] = append(d.outputCallbacks[index], fn)
 }
 
+// RegisterEffect calls fn whenever a conditional rule selects a lighting effect for an output, 0 returns the
+// output to its normal effect
+func (d *Decoder) RegisterEffect(output string, fn EffectCallback) {
+	if d.effectCallbacks == nil {
+		d.effectCallbacks = make(map[uint16][]EffectCallback)
+	}
+	index := IndexFromOutput(output)
+	d.effectCallbacks[index] = append(d.effectCallbacks[index], fn)
+}
+
+// setOutput calls the handlers registered for an output index
+func (d *Decoder) setOutput(index uint16, on bool) {
+	for _, fn := range d.outputCallbacks[index] {
+		fn(index, on)
+	}
+}
+
+// consistHeadlight checks whether FL sent to the consist address applies in our current direction. CV22 bit 0
+// enables it running forward and bit 1 in reverse, so the middle units of a consist can keep their lights off
+func (d *Decoder) consistHeadlight() bool {
+	if d.motor.Direction() == motor.Reverse {
+		return d.consistFL&0b10 != 0
+	}
+	return d.consistFL&0b01 != 0
+}
+
+// headlightInSpeed reports whether FL is carried by the C bit of the 14-step speed instruction. CV29 bit 1 selects
+// 14 steps when clear, and then bit 4 of function group one has no meaning
+func (d *Decoder) headlightInSpeed() bool {
+	return d.motor.SpeedMode() == motor.SpeedMode14
+}
+
+// consistFunction reports whether a function sent to the consist address is enabled by CVs 21 and 22. They only
+// cover FL and F1-F12, everything above is left to the unit's own address
+func (d *Decoder) consistFunction(number uint16) bool {
+	switch {
+	case number == 0:
+		return d.consistHeadlight()
+	case number <= 12:
+		group := (number - 1) / 4
+		return d.consistFuncMask[group]&(1<<((number-1)%4)) != 0
+	default:
+		return false
+	}
+}
+
+// extendedMap returns the outputs mapped to a function in an extended function mapping page, if the entry is
+// enabled. The first CV holds outputs 0-7 and the second outputs 8-12, with bit 7 enabling the entry
+func (d *Decoder) extendedMap(page, number uint16) (uint16, bool) {
+	if d.cv == nil || number > maxFunction {
+		return 0, false
+	}
+	cvNumber := functionMapBase + 2*number
+	hi := d.cv.IndexedCV(page, cvNumber+1)
+	if hi&functionMapEnable == 0 {
+		return 0, false
+	}
+	return uint16(hi&0x1F)<<8 | uint16(d.cv.IndexedCV(page, cvNumber)), true
+}
+
+// functionMaps returns the forward and reverse outputs of a function. Enabled extended mapping entries take the
+// place of CVs 33-46, and without a reverse map the forward outputs are used in both directions
+func (d *Decoder) functionMaps(number uint16) (fwd, rev uint16, ok, hasReverse bool) {
+	fwd, hasForward := d.extendedMap(cv.FunctionMapForwardPage, number)
+	rev, hasReverse = d.extendedMap(cv.FunctionMapReversePage, number)
+	if hasForward || hasReverse {
+		return fwd, rev, true, hasReverse
+	}
+	fwd, ok = d.outputMapsFwd[number]
+	rev, hasReverse = d.outputMapsRev[number]
+	return fwd, rev, ok, hasReverse
+}
+
 // Control DCC functions
 func (d *Decoder) callFunction(number uint16, on bool) {
-	var ok bool
-	// If there's no separate reverse callback use forward instead
-	outputMap, hasReverse := d.outputMapsRev[number]
-	direction := d.motor.Direction()
-	if direction == motor.Forward || !hasReverse {
-		outputMap, ok = d.outputMapsFwd[number]
-	}
-	if !ok {
+	d.setFunction(number, on)
+	d.updateOutputs()
+}
+
+// setFunction stores a function state without switching any outputs. Instructions carrying several functions set
+// them all first and then call updateOutputs once
+func (d *Decoder) setFunction(number uint16, on bool) {
+	if number > maxFunction {
 		return
 	}
+	if on {
+		d.functionStates[number/32] |= 1 << (number % 32)
+	} else {
+		d.functionStates[number/32] &^= 1 << (number % 32)
+	}
+}
+
+// Function returns the last state received for a function
+func (d *Decoder) Function(number uint16) bool {
+	if number > maxFunction {
+		return false
+	}
+	return d.functionStates[number/32]&(1<<(number%32)) != 0
+}
 
-	// If the direction has changed from reverse to forward and this function has separate forward/reverse
-	// output maps turn off the outputs that would have been on in reverse. Not needed if there's no
-	// separate reverse output map, as the forward map is used for both directions
-	if d.lastDirection != direction && hasReverse {
-		d.lastDirection = direction
+// updateOutputs works out the outputs of every function that's on for the current direction, applies the
+// conditional rules on top and switches the outputs that changed
+func (d *Decoder) updateOutputs() {
+	direction := d.motor.Direction()
+	d.lastDirection = direction
+	d.lastMoving = d.motor.Moving()
 
-		outputMapPrev := d.outputMapsRev[number]
-		if direction == motor.Reverse {
-			outputMapPrev = d.outputMapsFwd[number]
-		}
-		for i := range 16 {
-			if outputMapPrev&(1<<i) != 0 {
-				// Turn off all the "on" outputs from the previous direction
-				if handlers, ok := d.outputCallbacks[number]; ok {
-					for _, fn := range handlers {
-						fn(outputMap, false)
-					}
+	// If there's no separate reverse map use forward instead
+	var outputs uint16
+	for i, word := range d.functionStates {
+		for bit := uint16(0); word != 0; bit++ {
+			if word&1 != 0 {
+				fwd, rev, ok, hasReverse := d.functionMaps(uint16(i)*32 + bit)
+				if ok && direction == motor.Reverse && hasReverse {
+					outputs |= rev
+				} else if ok {
+					outputs |= fwd
 				}
 			}
+			word >>= 1
 		}
 	}
+	outputs, effects := d.applyRules(outputs)
 
-	for i := range 16 {
-		if outputMap&(1<<i) != 0 {
-			if handlers, ok := d.outputCallbacks[number]; ok {
-				for _, fn := range handlers {
-					fn(number, on)
-				}
+	// Effects are selected before switching on, so an output doesn't flash on without its effect first
+	for i, effect := range effects {
+		if effect != d.outputEffects[i] {
+			d.outputEffects[i] = effect
+			for _, fn := range d.effectCallbacks[uint16(i)] {
+				fn(uint16(i), effect)
 			}
 		}
 	}
+	changed := outputs ^ d.outputStates
+	d.outputStates = outputs
+	d.setOutputs(changed&^outputs, false)
+	d.setOutputs(changed&outputs, true)
+}
+
+// setOutputs switches every output in a function's output map
+func (d *Decoder) setOutputs(outputMap uint16, on bool) {
+	for i := range uint16(16) {
+		if outputMap&(1<<i) != 0 {
+			d.setOutput(i, on)
+		}
+	}
 }
 
 func IndexFromOutput(output string) uint16 {
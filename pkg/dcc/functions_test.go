@@ -0,0 +1,138 @@
+package dcc
+
+import (
+	"testing"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/cv"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/hal"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/motor"
+)
+
+// newIndexedTestDecoder builds a decoder on the real CV handler, as the mock has no index pages, along with a
+// function to set CVs in any page
+func newIndexedTestDecoder(t *testing.T) (*Decoder, func(index, cvNumber uint16, value uint8)) {
+	t.Helper()
+	cvs := cv.NewCVHandler([]uint8{1, 2, 3})
+	hw := hal.NewHAL()
+	m := motor.NewMotor(cvs, hw, shared.MockPin(1), shared.MockPin(2), shared.MockPin(3), shared.MockPin(4))
+	d, err := NewDecoder(cvs, m, 0, hw, nil)
+	if err != nil {
+		t.Fatalf("NewDecoder() error: %v", err)
+	}
+
+	set := func(index, cvNumber uint16, value uint8) {
+		t.Helper()
+		page := cvs.IndexPage()
+		if index != page {
+			// Select the page with CV31/32
+			cv31, cv32 := uint8(0), uint8(0)
+			if index > 0 {
+				cv31, cv32 = 16, uint8(index-1)
+			}
+			if !cvs.IndexedSetSync(page, 31, cv31) || !cvs.IndexedSetSync(cvs.IndexPage(), 32, cv32) {
+				t.Fatalf("could not select index page %d", index)
+			}
+		}
+		if !cvs.IndexedSetSync(index, cvNumber, value) {
+			t.Fatalf("could not set CV%d in index page %d", cvNumber, index)
+		}
+	}
+	return d, set
+}
+
+func TestExtendedFunctionMapping(t *testing.T) {
+	d, set := newIndexedTestDecoder(t)
+
+	outputs := make(map[uint16]bool)
+	for _, output := range []string{"lampFront", "lampRear", "aux1", "aux2", "aux3", "aux12"} {
+		d.RegisterOutput(output, func(index uint16, on bool) {
+			outputs[index] = on
+		})
+	}
+
+	// F20 forward on aux1 and aux12, F0 forward on aux3 in place of CV33
+	set(1, functionMapBase+2*20, 0b100)
+	set(1, functionMapBase+2*20+1, functionMapEnable|0b10000)
+	set(1, functionMapBase, 0b10000)
+	set(1, functionMapBase+1, functionMapEnable)
+	// F20 reverse on aux2
+	set(2, functionMapBase+2*20, 0b1000)
+	set(2, functionMapBase+2*20+1, functionMapEnable)
+
+	tests := []struct {
+		name    string
+		reverse bool
+		number  uint16
+		expect  map[uint16]bool
+	}{
+		{name: "F20 forward", number: 20, expect: map[uint16]bool{2: true, 12: true}},
+		{name: "F0 replaces CV33", number: 0, expect: map[uint16]bool{4: true}},
+		{name: "F20 reverse", reverse: true, number: 20, expect: map[uint16]bool{3: true}},
+		{name: "F13 unmapped", number: 13, expect: map[uint16]bool{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// CV29 bit 0 reverses our normal direction, standing in for running in reverse
+			cv29 := uint8(0b10)
+			if tt.reverse {
+				cv29 |= 1
+			}
+			set(0, 29, cv29)
+			clear(outputs)
+
+			d.callFunction(tt.number, true)
+			for index, on := range outputs {
+				if on != tt.expect[index] {
+					t.Errorf("output %d = %v, want %v", index, on, tt.expect[index])
+				}
+			}
+			for index := range tt.expect {
+				if !outputs[index] {
+					t.Errorf("output %d not switched on", index)
+				}
+			}
+			d.callFunction(tt.number, false)
+		})
+	}
+}
+
+func TestFunctionOutputIndex(t *testing.T) {
+	// CV38 maps F4 to aux2 by default, which must switch output 3 rather than the function number
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 29: 0b10, 38: 0b0001})
+
+	outputs := make(map[uint16]bool)
+	for _, output := range []string{"aux2", "aux3"} {
+		d.RegisterOutput(output, func(index uint16, on bool) {
+			outputs[index] = on
+		})
+	}
+
+	d.callFunction(4, true)
+	if !outputs[3] || outputs[4] {
+		t.Errorf("aux2 = %v, aux3 = %v, want only aux2 on", outputs[3], outputs[4])
+	}
+}
+
+// TestFunctionGroupOutputs tests that the outputs are only switched once all of an instruction's functions are set
+func TestFunctionGroupOutputs(t *testing.T) {
+	// FL and F1 both map to the front lamp
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 29: 0b10, 33: 0b01, 35: 0b01})
+	msg := NewMessage(d.cv, d)
+
+	switches := 0
+	d.RegisterOutput("lampFront", func(uint16, bool) { switches++ })
+
+	// FL on, then FL off and F1 on in the same instruction, which leaves the lamp on throughout
+	processPackets(msg, withChecksum(3, 0b10010000), withChecksum(3, 0b10000001))
+	if switches != 1 {
+		t.Errorf("front lamp switched %d times, want 1", switches)
+	}
+
+	// The same through the speed, direction and functions instruction
+	processPackets(msg, withChecksum(3, 0x3C, 0x80, 0b01))
+	if switches != 1 {
+		t.Errorf("front lamp switched %d times, want 1", switches)
+	}
+}
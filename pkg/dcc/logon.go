@@ -0,0 +1,230 @@
+package dcc
+
+import "math/rand"
+
+// DCC-A automatic logon (RCN-218)
+const (
+	// Manufacturer ID reported when logging on, matching CV8
+	logonManufacturer = 0x0D
+
+	// LOGON_ENABLE groups
+	logonGroupAll  = 0b00
+	logonGroupLoco = 0b01
+	logonGroupAcc  = 0b10
+	logonGroupNow  = 0b11
+
+	// SELECT sub-commands
+	logonSelectShortInfo = 0xFF
+
+	// Answers to LOGON_ENABLE are spread over a random number of LOGON_ENABLE packets to avoid collisions
+	logonBackoff = 8
+
+	// Address ranges used by LOGON_ASSIGN and ShortInfo, below the accessory range is a multi-function address
+	logonAccessoryBase    = 0x2800
+	logonExtAccessoryBase = 0x3000
+	logonReservedBase     = 0x3800
+
+	// Highest function number reported in ShortInfo
+	logonMaxFunction = 68
+)
+
+type logonState struct {
+	// Command station ID and session from the last LOGON_ENABLE
+	cid     uint16
+	session uint8
+
+	// Waiting out the backoff before answering LOGON_ENABLE
+	pending bool
+	backoff int
+
+	// Data selected for reading with GET_DATA_START/GET_DATA_CONT
+	selected bool
+	data     []byte
+	offset   int
+
+	// 48-bit reply to be sent in the next RailCom cutout (channel 1 and 2 combined)
+	reply   [6]byte
+	replyOk bool
+}
+
+// crc8 is the Dallas/Maxim CRC (x^8 + x^5 + x^4 + 1) used by DCC-A
+func crc8(b []byte) uint8 {
+	var crc uint8
+	for _, v := range b {
+		crc ^= v
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8C
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// loggedOn checks whether we've already been assigned an address by this command station session
+func (d *Decoder) loggedOn(cid uint16, session uint8) bool {
+	return uint16(d.cv.CV(124))<<8|uint16(d.cv.CV(125)) == cid && d.cv.CV(126) == session
+}
+
+// logonMatch checks the manufacturer and unique ID addressing a SELECT or LOGON_ASSIGN command
+// 1MMMMMMM MMMMMMMM UUUUUUUU UUUUUUUU UUUUUUUU UUUUUUUU
+func (d *Decoder) logonMatch(b []byte) bool {
+	manufacturer := uint16(b[0]&0x0F)<<8 | uint16(b[1])
+	id := uint32(b[2])<<24 | uint32(b[3])<<16 | uint32(b[4])<<8 | uint32(b[5])
+	return manufacturer == logonManufacturer && id == d.uniqueID
+}
+
+func (d *Decoder) queueLogonReply(reply [6]byte) {
+	d.logon.reply = reply
+	d.logon.replyOk = true
+}
+
+// logonEnable answers LOGON_ENABLE with our unique ID (ID15) if we haven't logged on to this session yet
+func (d *Decoder) logonEnable(group uint8, cid uint16, session uint8) bool {
+	l := &d.logon
+	l.cid = cid
+	l.session = session
+
+	switch group {
+	case logonGroupLoco:
+		if d.accessory {
+			return false
+		}
+	case logonGroupAcc:
+		if !d.accessory {
+			return false
+		}
+	}
+
+	if d.loggedOn(cid, session) {
+		l.pending = false
+		return false
+	}
+
+	if group == logonGroupNow {
+		l.backoff = 0
+	} else if !l.pending {
+		l.pending = true
+		l.backoff = rand.Intn(logonBackoff)
+	}
+	if l.backoff > 0 {
+		l.backoff--
+		return false
+	}
+
+	// Any further LOGON_ENABLE without an assignment means we collided with another decoder, back off again
+	l.pending = false
+	id := d.uniqueID
+	d.queueLogonReply([6]byte{
+		0xF0 | logonManufacturer>>8, logonManufacturer & 0xFF,
+		byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id),
+	})
+	return true
+}
+
+// logonSelect handles the sub-command of a SELECT addressed to us
+func (d *Decoder) logonSelect(b []byte) bool {
+	l := &d.logon
+	l.selected = false
+	if len(b) == 0 {
+		return false
+	}
+
+	switch b[0] {
+	case logonSelectShortInfo:
+		info := d.logonShortInfo()
+		l.data = append(l.data[:0], info[:]...)
+		l.offset = 0
+		l.selected = true
+		d.queueLogonReply(info)
+		return true
+	}
+	// Other data spaces aren't supported
+	return false
+}
+
+// logonShortInfo builds the ShortInfo reply
+// 10AAAAAA AAAAAAAA FFFFFFFF CCCCCCCC 00000000 CRC8
+// A = current address (same ranges as LOGON_ASSIGN)
+// F = highest supported function number
+// C = capabilities, bit 0: RailCom
+func (d *Decoder) logonShortInfo() [6]byte {
+	var addr uint16
+	if d.accessory {
+		addr = logonAccessoryBase + uint16(max(d.accessoryBase, 0))&0x7FF
+	} else {
+		addr, _ = d.addressValue()
+	}
+
+	info := [6]byte{0x80 | byte(addr>>8), byte(addr), logonMaxFunction, 0b00000001, 0}
+	info[5] = crc8(info[:5])
+	return info
+}
+
+// logonGetData returns the next 48 bits of the data selected with SELECT
+func (d *Decoder) logonGetData(cont bool) bool {
+	l := &d.logon
+	if !l.selected {
+		return false
+	}
+	if !cont {
+		l.offset = 0
+	}
+	if l.offset >= len(l.data) {
+		return false
+	}
+
+	var reply [6]byte
+	l.offset += copy(reply[:], l.data[l.offset:])
+	d.queueLogonReply(reply)
+	return true
+}
+
+// logonAssign takes on the address assigned by the command station and remembers the session so we don't
+// log on again, answering with our decoder state (ID13)
+func (d *Decoder) logonAssign(addr uint16) bool {
+	addr &= 0x3FFF
+	index := d.cv.IndexPage()
+	cv29 := d.cv.CV(29)
+
+	ok := false
+	switch {
+	case addr == 0:
+		// Not a valid address
+	case addr < logonAccessoryBase:
+		// Multi-function decoders are always assigned a long address
+		ok = d.cv.IndexedSetSync(index, 18, byte(addr)) &&
+			d.cv.IndexedSetSync(index, 17, 0xC0|byte(addr>>8)) &&
+			d.cv.IndexedSetSync(index, 29, cv29|0b00100000)
+	case addr < logonReservedBase:
+		// Basic and extended accessory addresses both use output addressing
+		out := (addr - logonAccessoryBase) & 0x7FF
+		if addr >= logonExtAccessoryBase {
+			out = addr - logonExtAccessoryBase
+		}
+		// Only the low 3 bits of CV9 are part of the address
+		ok = d.cv.IndexedSetSync(index, 1, byte(out)) &&
+			d.cv.IndexedSetSync(index, 9, d.cv.CV(9)&^0b111|byte(out>>8)) &&
+			d.cv.IndexedSetSync(index, 29, cv29|0b01000000)
+	}
+	if !ok {
+		return false
+	}
+
+	l := &d.logon
+	l.pending = false
+	d.cv.SetSync(124, byte(l.cid>>8))
+	d.cv.SetSync(125, byte(l.cid))
+	d.cv.SetSync(126, l.session)
+
+	// Decoder state, no pending changes to report
+	// 1101FFFF FFFFCCCC CCCCCCCC 00000000 00000000 CRC8
+	// F = change flags
+	// C = change counter
+	state := [6]byte{0xD0}
+	state[5] = crc8(state[:5])
+	d.queueLogonReply(state)
+	return true
+}
@@ -0,0 +1,169 @@
+package dcc
+
+import "testing"
+
+// testLogonPacket builds a DCC-A command with its CRC8 when the command carries one
+func testLogonPacket(crc bool, b ...byte) []byte {
+	b = append([]byte{254}, b...)
+	if crc {
+		b = append(b, crc8(b))
+	}
+	return withChecksum(b...)
+}
+
+func TestCRC8(t *testing.T) {
+	// Check value for CRC-8/MAXIM
+	if got := crc8([]byte("123456789")); got != 0xA1 {
+		t.Errorf("crc8() = %#02x, want 0xa1", got)
+	}
+}
+
+func TestLogon(t *testing.T) {
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 9: 40, 17: 192, 18: 0, 29: 0b00001010, 124: 0, 125: 0, 126: 0})
+	msg := NewMessage(d.cv, d)
+
+	// Manufacturer 0x00D, unique ID 0x12345678 from the mock HAL
+	id := []byte{0x00, 0x0D, 0x12, 0x34, 0x56, 0x78}
+	enable := testLogonPacket(false, 0b11111100, 0x12, 0x34, 7)
+
+	// Everyone answers LOGON_ENABLE eventually, after a random number of packets
+	answered := false
+	for range logonBackoff {
+		processPackets(msg, enable)
+		if d.logon.replyOk {
+			answered = true
+			break
+		}
+	}
+	if !answered {
+		t.Fatalf("no reply to LOGON_ENABLE after %d packets", logonBackoff)
+	}
+	if want := [6]byte{0xF0, 0x0D, 0x12, 0x34, 0x56, 0x78}; d.logon.reply != want {
+		t.Errorf("LOGON_ENABLE reply = % x, want % x", d.logon.reply, want)
+	}
+
+	// SELECT ShortInfo for another decoder is ignored
+	d.logon.replyOk = false
+	processPackets(msg, testLogonPacket(true, 0xD0, 0x0D, 0x12, 0x34, 0x56, 0x79, logonSelectShortInfo))
+	if d.logon.replyOk {
+		t.Errorf("replied to SELECT for another decoder")
+	}
+
+	// A bad CRC is ignored
+	bad := testLogonPacket(true, 0xD0|id[0], id[1], id[2], id[3], id[4], id[5], logonSelectShortInfo)
+	bad[len(bad)-2] ^= 0xFF
+	bad[len(bad)-1] ^= 0xFF
+	processPackets(msg, bad)
+	if d.logon.replyOk {
+		t.Errorf("replied to SELECT with a bad CRC")
+	}
+
+	processPackets(msg, testLogonPacket(true, 0xD0|id[0], id[1], id[2], id[3], id[4], id[5], logonSelectShortInfo))
+	if !d.logon.replyOk {
+		t.Fatalf("no reply to SELECT ShortInfo")
+	}
+	if got := d.logon.reply; got[0] != 0x80 || got[1] != 3 || got[2] != logonMaxFunction || got[5] != crc8(got[:5]) {
+		t.Errorf("ShortInfo = % x, want short address 3 and max function %d", got, logonMaxFunction)
+	}
+
+	// GET_DATA_START repeats the selected data from the beginning, there's nothing more to continue with
+	d.logon.replyOk = false
+	processPackets(msg, testLogonPacket(false, 0x00))
+	if !d.logon.replyOk || d.logon.reply[1] != 3 {
+		t.Errorf("GET_DATA_START reply = % x (%t), want ShortInfo", d.logon.reply, d.logon.replyOk)
+	}
+	d.logon.replyOk = false
+	processPackets(msg, testLogonPacket(false, 0x01))
+	if d.logon.replyOk {
+		t.Errorf("replied to GET_DATA_CONT past the end of the data")
+	}
+
+	// LOGON_ASSIGN long address 1234
+	processPackets(msg, testLogonPacket(true, 0xE0|id[0], id[1], id[2], id[3], id[4], id[5], 0x04, 0xD2))
+	if !d.logon.replyOk || d.logon.reply[0]&0xF0 != 0xD0 {
+		t.Errorf("LOGON_ASSIGN reply = % x (%t), want decoder state", d.logon.reply, d.logon.replyOk)
+	}
+	if cv17, cv18, cv29 := d.cv.CV(17), d.cv.CV(18), d.cv.CV(29); cv17 != 0xC4 || cv18 != 0xD2 || cv29&0b00100000 == 0 {
+		t.Errorf("CV17/18/29 = %d/%d/%08b, want 196/210 with long addressing", cv17, cv18, cv29)
+	}
+	if cid, session := uint16(d.cv.CV(124))<<8|uint16(d.cv.CV(125)), d.cv.CV(126); cid != 0x1234 || session != 7 {
+		t.Errorf("CID/session = %#04x/%d, want 0x1234/7", cid, session)
+	}
+
+	// Logged on decoders stay quiet for the rest of the session, even for LOGON_ENABLE NOW
+	d.logon.replyOk = false
+	now := testLogonPacket(false, 0b11111111, 0x12, 0x34, 7)
+	processPackets(msg, now)
+	if d.logon.replyOk {
+		t.Errorf("logged on decoder replied to LOGON_ENABLE")
+	}
+
+	// A new session logs on again
+	processPackets(msg, testLogonPacket(false, 0b11111111, 0x12, 0x34, 8))
+	if !d.logon.replyOk {
+		t.Errorf("no reply to LOGON_ENABLE for a new session")
+	}
+}
+
+func TestLogonGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		cvs    map[uint16]uint8
+		group  uint8
+		expect bool
+	}{
+		{
+			name:   "Locomotive group",
+			cvs:    map[uint16]uint8{1: 3, 29: 0b00001010},
+			group:  logonGroupLoco,
+			expect: true,
+		},
+		{
+			name:   "Accessory group",
+			cvs:    map[uint16]uint8{1: 3, 29: 0b00001010},
+			group:  logonGroupAcc,
+			expect: false,
+		},
+		{
+			name:   "Accessory decoder in accessory group",
+			cvs:    map[uint16]uint8{1: 1, 9: 40, 29: 0b10001000},
+			group:  logonGroupAcc,
+			expect: true,
+		},
+		{
+			name:   "RailCom disabled",
+			cvs:    map[uint16]uint8{1: 3, 29: 0b00000010},
+			group:  logonGroupNow,
+			expect: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cvs[124], tt.cvs[125], tt.cvs[126] = 0, 0, 0
+			d, _ := newTestDecoder(t, tt.cvs)
+			msg := NewMessage(d.cv, d)
+
+			for range logonBackoff {
+				processPackets(msg, testLogonPacket(false, 0b11111100|tt.group, 0x12, 0x34, 1))
+			}
+			if d.logon.replyOk != tt.expect {
+				t.Errorf("replied = %t, want %t", d.logon.replyOk, tt.expect)
+			}
+		})
+	}
+}
+
+func TestLogonAssignAccessory(t *testing.T) {
+	d, _, _ := newTestAccessory(t, map[uint16]uint8{1: 1, 9: 40, 29: 0b10001000, 124: 0, 125: 0, 126: 0})
+	msg := NewMessage(d.cv, d)
+
+	// Output address 300 in the basic accessory range
+	addr := uint16(logonAccessoryBase + 300)
+	processPackets(msg,
+		testLogonPacket(false, 0b11111110, 0x12, 0x34, 1),
+		testLogonPacket(true, 0xE0, 0x0D, 0x12, 0x34, 0x56, 0x78, byte(addr>>8), byte(addr)))
+	if cv1, cv9, cv29 := d.cv.CV(1), d.cv.CV(9), d.cv.CV(29); cv1 != 44 || cv9 != 41 || cv29&0b11000000 != 0b11000000 {
+		t.Errorf("CV1/9/29 = %d/%d/%08b, want 44/41 with output addressing", cv1, cv9, cv29)
+	}
+}
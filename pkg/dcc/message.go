@@ -1,7 +1,9 @@
 package dcc
 
 import (
+	"bytes"
 	"sync"
+	"time"
 
 	"github.com/mikesmitty/rp24-dcc-decoder/pkg/cv"
 	"github.com/mikesmitty/rp24-dcc-decoder/pkg/motor"
@@ -14,6 +16,7 @@ const (
 	ServiceMsg
 	ExtendedMsg
 	AdvancedExtendedMsg
+	AccessoryMsg
 )
 
 type AddressType int
@@ -24,6 +27,8 @@ const (
 	DirectAddress
 	ConsistAddress
 	IdleAddress
+	AccessoryAddress
+	LogonAddress
 )
 
 type Message struct {
@@ -36,7 +41,12 @@ type Message struct {
 	decoder *Decoder
 
 	cvConfirm map[uint16]uint8
-	lastXPOM  []byte
+	pending   []byte
+	// Whether the pending instruction has been acted on, any further repeats of it are ignored
+	pendingDone bool
+
+	// Whether the last packet was sent to our own address, allowing a RailCom channel 2 reply
+	addressed bool
 }
 
 func NewMessage(cvHandler cv.Handler, decoder *Decoder) *Message {
@@ -45,7 +55,7 @@ func NewMessage(cvHandler cv.Handler, decoder *Decoder) *Message {
 		cv:        cvHandler,
 		cvConfirm: make(map[uint16]uint8),
 		decoder:   decoder,
-		lastXPOM:  make([]byte, 0, 8),
+		pending:   make([]byte, 0, maxMsgLength),
 	}
 }
 
@@ -72,6 +82,30 @@ func (m *Message) Reset() {
 	m.msgType = UnknownMsg
 }
 
+// resetVolatile drops any pending multi-packet state, e.g. when a decoder reset packet is received
+func (m *Message) resetVolatile() {
+	m.pending = m.pending[:0]
+	m.pendingDone = false
+	clear(m.cvConfirm)
+}
+
+// confirmed reports whether the current packet is a repeat of the previous one. Instructions that
+// modify CVs must not be acted on until two identical packets have been received in a row (S-9.2.1,
+// S-9.2.3), so the first copy is held as pending and false is returned. Command stations keep repeating
+// the instruction after that, so it's only acted on once until a different packet arrives
+func (m *Message) confirmed() bool {
+	if len(m.pending) > 0 && bytes.Equal(m.pending, m.buf) {
+		if m.pendingDone {
+			return false
+		}
+		m.pendingDone = true
+		return true
+	}
+	m.pending = append(m.pending[:0], m.buf...)
+	m.pendingDone = false
+	return false
+}
+
 func (m *Message) XOR() bool {
 	var xor byte
 	for _, b := range m.buf {
@@ -102,14 +136,32 @@ func (m *Message) Process() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if !m.decoder.Snoop && (!m.checkAddress() || m.addr == UnknownAddress) {
-		// Ignore messages not addressed to us if we're not being nosy
-		return
-	}
+	// Every valid packet counts towards entering or leaving service mode, regardless of address
+	m.updateOpMode()
 
 	// Check the message type to determine how to handle it
 	m.msgType = m.messageType()
 
+	// Service mode packets aren't addressed to any particular decoder
+	m.addressed = false
+	if m.msgType != ServiceMsg {
+		ours := m.checkAddress() && m.addr != UnknownAddress
+		if !ours && !m.decoder.Snoop {
+			// Ignore messages not addressed to us if we're not being nosy
+			return
+		}
+		m.addressed = ours && (m.addr == DirectAddress || m.addr == AccessoryAddress)
+		if m.addressed || ours && m.addr == ConsistAddress {
+			m.decoder.packetReceived(time.Now())
+		}
+	}
+
+	// Any other packet received in between invalidates a pending instruction
+	if !bytes.Equal(m.pending, m.buf) {
+		m.pending = m.pending[:0]
+		m.pendingDone = false
+	}
+
 	ok := false
 	switch m.msgType {
 	case ServiceMsg:
@@ -118,24 +170,15 @@ func (m *Message) Process() {
 		m.extendedPacket(m.buf)
 	case AdvancedExtendedMsg:
 		m.advancedExtendedPacket(m.buf)
+	case AccessoryMsg:
+		m.accessoryPacket(m.buf)
 	default:
 		// Unknown message type
 	}
 
 	if ok {
 		m.decoder.BasicAck()
-		// FIXME: Advanced Ack usage?
-		// m.decoder.AdvancedAck([]byte{ackByte}, []byte{})
 	}
-
-	// respByte := nackByte
-	// if ok {
-	// 	respByte = ackByte
-	// }
-	// err := m.decoder.AdvancedAck([]byte{respByte}, []byte{})
-	// if err != nil {
-	// 	// println("Error sending ack:", err.Error()) // FIXME: Cleanup
-	// }
 }
 
 func (m *Message) messageType() MessageType {
@@ -150,8 +193,9 @@ func (m *Message) messageType() MessageType {
 		if b >= 112 && b <= 127 {
 			// Received a service mode packet
 			return ServiceMsg
-		} else {
-			// Ignore non-service mode packets while in service mode
+		} else if !m.isResetPacket() {
+			// Ignore non-service mode packets while in service mode, reset packets still need
+			// processing to keep the service mode window open
 			return UnknownMsg
 		}
 	}
@@ -162,8 +206,10 @@ func (m *Message) messageType() MessageType {
 	} else if b == 253 || b == 254 {
 		// Advanced extended message format
 		return AdvancedExtendedMsg
+	} else if b >= 128 && b <= 191 && m.decoder.accessory {
+		// Accessory decoder packets are only of interest in accessory mode
+		return AccessoryMsg
 	}
-	// We're intentionally ignoring accessory decoder messages for now, may implement later
 	// Basic messages are superseded by extended messages
 	return UnknownMsg
 }
@@ -185,8 +231,7 @@ func (m *Message) motionCommand(bytes []byte) (uint8, bool, bool) {
 			// 14-speed mode: 01DCSSSS
 			// D: Direction (0 = reverse, 1 = forward)
 			// S: Speed step (0-15)
-			// C: Ignored
-			// No changes needed
+			// C: FL (F0), see speedHeadlight
 		} else {
 			// 28-speed mode: 01DLSSSS
 			// D: Direction (0 = reverse, 1 = forward)
@@ -236,18 +281,31 @@ func (m *Message) checkAddress() bool {
 		m.addr = BroadcastAddress
 		return true
 	case 0xFF:
-		// Idle packet, ignore
+		// Idle packet, ignore. It's already been counted by updateOpMode for leaving service mode
 		m.addr = IdleAddress
-		// TODO: Idle packets count as valid data packets to return to operations mode, I think?
-	case 253, 254:
-		// Advanced extended packet format, not supported yet
+	case 254:
+		// DCC-A automatic logon commands are addressed to all decoders
+		m.addr = LogonAddress
+		return true
+	case 253:
+		// Advanced extended packet format, reserved for future use
 	default:
-		// We don't know how to interprest accessory decoder messages
 		if m.buf[0] >= 128 && m.buf[0] <= 191 {
+			// Accessory decoder address
+			if _, ok := m.accessoryPair(); ok && m.decoder.accessory {
+				m.addr = AccessoryAddress
+				return true
+			}
 			m.addr = UnknownAddress
 			return false
 		}
 
+		if m.decoder.accessory {
+			// Accessory decoders don't respond to multi-function decoder addresses
+			m.addr = UnknownAddress
+			return m.decoder.Snoop
+		}
+
 		// Check for direct or consist address match
 		if m.addressMatch(m.decoder.address) {
 			m.addr = DirectAddress
@@ -269,7 +327,8 @@ func (m *Message) checkAddress() bool {
 
 // addressMatch checks if the first bytes of the message match the provided buffer
 func (m *Message) addressMatch(b []byte) bool {
-	if len(b) > len(m.buf) {
+	// An unset address (e.g. no active consist) never matches
+	if len(b) == 0 || len(b) > len(m.buf) {
 		return false
 	}
 	for i, v := range b {
@@ -0,0 +1,105 @@
+package dcc
+
+// accessoryPair returns which of our output pairs an accessory packet is addressed to
+func (m *Message) accessoryPair() (uint8, bool) {
+	if len(m.buf) < 3 {
+		return 0, false
+	}
+
+	decoder := m.accessoryDecoder()
+	pair := int(m.buf[1] >> 1 & 0b11)
+	if decoder == accessoryBroadcastAddress {
+		return uint8(pair), true
+	}
+
+	pair = accessoryOutputAddress(decoder, pair) - m.decoder.accessoryBase
+	if pair < 0 || pair >= accessoryPairs {
+		return 0, false
+	}
+	return uint8(pair), true
+}
+
+func (m *Message) accessoryPacket(b []byte) bool {
+	l := len(b)
+	if l < 3 {
+		return false
+	}
+
+	pair, ok := m.accessoryPair()
+	if !ok {
+		return false
+	}
+
+	if b[1]&0b10000000 == 0 {
+		return m.extendedAccessoryPacket(b, pair)
+	}
+
+	switch l {
+	case 3:
+		// Basic accessory decoder packet
+		// 10AAAAAA 1AAADAAR
+		// D: 1 = activate, 0 = deactivate
+		// R: Output of the pair
+		m.decoder.setAccessoryOutput(pair, b[1]&1, b[1]&0b1000 != 0)
+		return true
+	case 6:
+		// Basic accessory decoder operations mode programming
+		// 10AAAAAA 1AAACDDD 1110CCVV VVVVVVVV DDDDDDDD
+		// CDDD selects an output's CVs, all of our outputs share the decoder's CVs
+		return m.accessoryCVAccess(b)
+	}
+	return false
+}
+
+func (m *Message) extendedAccessoryPacket(b []byte, head uint8) bool {
+	l := len(b)
+	if b[1]&0b10001001 != 0b00000001 {
+		// Not an extended accessory packet
+		return false
+	}
+
+	switch l {
+	case 4:
+		// Extended accessory decoder packet
+		// 10AAAAAA 0AAA0AA1 DDDDDDDD
+		// D: Signal aspect
+		if m.accessoryBroadcast() {
+			// Broadcasts set every signal head, normally to aspect 0 for an emergency stop
+			for head := range uint8(signalHeads) {
+				m.decoder.setSignalAspect(head, b[2])
+			}
+			return true
+		}
+		m.decoder.setSignalAspect(head, b[2])
+		return true
+	case 6:
+		// Extended accessory decoder operations mode programming
+		// 10AAAAAA 0AAA0AA1 1110CCVV VVVVVVVV DDDDDDDD
+		return m.accessoryCVAccess(b)
+	}
+	return false
+}
+
+// accessoryCVAccess handles the long form CV access instruction following an accessory address
+func (m *Message) accessoryCVAccess(b []byte) bool {
+	if m.accessoryBroadcast() {
+		// Not accepting CV changes via broadcast
+		return false
+	}
+	if b[2]&0xF0 != 0xE0 {
+		return false
+	}
+	return m.configVariableAccessInstruction(b[2 : len(b)-1])
+}
+
+// accessoryDecoder returns the 9-bit decoder address of an accessory packet
+func (m *Message) accessoryDecoder() int {
+	// 10AAAAAA .AAA....
+	// The three address MSBs in the second byte are sent inverted
+	return int(^m.buf[1]>>4&0b111)<<6 | int(m.buf[0]&0b00111111)
+}
+
+// accessoryBroadcast checks for the accessory broadcast address
+func (m *Message) accessoryBroadcast() bool {
+	return m.accessoryDecoder() == accessoryBroadcastAddress
+}
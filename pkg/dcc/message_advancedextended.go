@@ -1,6 +1,51 @@
 package dcc
 
 func (m *Message) advancedExtendedPacket(b []byte) bool {
-	// TODO: To be implemented
+	if len(b) < 3 || b[0] != 254 {
+		// Address 253 is reserved for future use
+		return false
+	}
+	if !m.decoder.railcomEnabled() {
+		// DCC-A depends on RailCom for answering
+		return false
+	}
+
+	// DCC-A commands (RCN-218), addressed to all decoders with 254
+	cmd := b[1 : len(b)-1]
+	l := len(cmd)
+	switch {
+	case l == 1 && (cmd[0] == 0x00 || cmd[0] == 0x01):
+		// GET_DATA_START/GET_DATA_CONT
+		// 0000000C
+		return m.decoder.logonGetData(cmd[0] == 0x01)
+	case l == 4 && cmd[0]&0b11111100 == 0b11111100:
+		// LOGON_ENABLE
+		// 111111GG ZZZZZZZZ ZZZZZZZZ SSSSSSSS
+		// G = group, Z = command station ID (CID), S = session ID
+		return m.decoder.logonEnable(cmd[0]&0b11, uint16(cmd[1])<<8|uint16(cmd[2]), cmd[3])
+	case l >= 8 && cmd[0]&0xF0 == 0b11010000:
+		// SELECT
+		// 1101MMMM MMMMMMMM UUUUUUUU UUUUUUUU UUUUUUUU UUUUUUUU SSSSSSSS [DDDDDDDD...] CRC8
+		// M = manufacturer, U = unique ID, S = sub-command
+		if !m.logonCRC() || !m.decoder.logonMatch(cmd[:6]) {
+			m.decoder.logon.selected = false
+			return false
+		}
+		return m.decoder.logonSelect(cmd[6 : l-1])
+	case l == 9 && cmd[0]&0xF0 == 0b11100000:
+		// LOGON_ASSIGN
+		// 1110MMMM MMMMMMMM UUUUUUUU UUUUUUUU UUUUUUUU UUUUUUUU AAAAAAAA AAAAAAAA CRC8
+		// M = manufacturer, U = unique ID, A = assigned address
+		if !m.logonCRC() || !m.decoder.logonMatch(cmd[:6]) {
+			return false
+		}
+		return m.decoder.logonAssign(uint16(cmd[6])<<8 | uint16(cmd[7]))
+	}
 	return false
 }
+
+// logonCRC checks the CRC8 covering a DCC-A command from the address byte onward
+func (m *Message) logonCRC() bool {
+	l := len(m.buf)
+	return crc8(m.buf[:l-2]) == m.buf[l-2]
+}
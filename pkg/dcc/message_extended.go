@@ -29,10 +29,11 @@ func (m *Message) extendedPacket(b []byte) bool {
 	case 0b010, 0b011:
 		// Speed and Direction Instruction
 		speed, reverse, ok := m.motionCommand(b[fb : l-1])
-		if ok {
-			m.decoder.motor.SetSpeed(speed, reverse)
+		if !ok || !m.setSpeed(speed, reverse) {
+			return false
 		}
-		return ok
+		m.speedHeadlight(b[fb])
+		return true
 	case 0b100:
 		return m.functionGroupOneInstruction(b[fb])
 	case 0b101:
@@ -63,6 +64,7 @@ func (m *Message) decoderConsistControlInstruction(b []byte) bool {
 		case 0b00000000:
 			if l == 1 && m.addr == BroadcastAddress {
 				println("reset packet received")
+				m.resetVolatile()
 				m.decoder.Reset()
 				return true
 			}
@@ -71,7 +73,8 @@ func (m *Message) decoderConsistControlInstruction(b []byte) bool {
 			m.cv.Reset(29)
 			m.cv.Reset(31)  // CV257-512 index
 			m.cv.Reset(32)  // CV257-512 index
-			m.cv.Set(19, 0) // Consist address
+			m.setConsist(0) // Consist address
+			m.resetVolatile()
 			m.decoder.Reset()
 			return true
 		case 0b00000010, 0b00000011:
@@ -87,17 +90,17 @@ func (m *Message) decoderConsistControlInstruction(b []byte) bool {
 	// 0b0001xxxx
 	case 0b0001:
 		/* Consist control 0001xxxx
-		TODO: Implement the other logic:
 		When Consist Control is in effect, the decoder will ignore any speed or direction instructions
 		addressed to its normal locomotive address (unless this address is the same as its consist address).
-		190 Speed and direction instructions now apply to the consist address only
+		Speed and direction instructions now apply to the consist address only (see setSpeed)
 
 		Functions controlled by Function Group One (100) and Function Group Two (101) will continue to
 		respond to the decoder’s baseline address. Functions controlled by instructions 100 and 101 also
 		respond to the consist address if the appropriate bits in CVs 21 and 22 have been activated.
 
 		By default, all forms of Bi-directional communication are not activated in response to commands
-		sent to the consist address until specifically activated by a Decoder Control instruction.
+		sent to the consist address until specifically activated by a Decoder Control instruction. We don't
+		support activating it, so consist-addressed packets are never answered in RailCom channel 2
 
 		https://www.nmra.org/sites/default/files/standards/sandrp/DCC/S/s-9.2.1_dcc_extended_packet_formats.pdf
 		Page 5
@@ -106,12 +109,12 @@ func (m *Message) decoderConsistControlInstruction(b []byte) bool {
 		case 0b00010010:
 			// Set consist address
 			if l > 1 && b[1] < 128 {
-				return m.cv.Set(19, b[1])
+				return m.setConsist(b[1])
 			}
 		case 0b00010011:
 			// Set consist address and reverse direction
 			if l > 1 {
-				return m.cv.Set(19, b[1]|0x80)
+				return m.setConsist(b[1] | 0x80)
 			}
 		}
 	}
@@ -120,12 +123,56 @@ func (m *Message) decoderConsistControlInstruction(b []byte) bool {
 
 func (m *Message) advancedOperationInstruction(b []byte) bool {
 	// 0b001xxxxx
-	// 128-step speed control
 	switch b[0] {
+	case 0b00111100:
+		// Speed, direction and functions (RCN-212)
+		// 00111100 RGGGGGGG [F7-F0 [F15-F8 [F23-F16 [F31-F24]]]]
+		if len(b) < 2 || len(b) > 6 {
+			return false
+		}
+		speed, reverse, ok := m.motionCommand([]byte{0b00111111, b[1]})
+		if ok {
+			ok = m.setSpeed(speed, reverse)
+		}
+		functions := false
+		for i, f := range b[2:] {
+			functions = m.functionByte(uint16(i)*8, f) || functions
+		}
+		if functions {
+			m.decoder.updateOutputs()
+		}
+		// Our own address's speed is ignored while we're in a consist but its functions still apply, so the
+		// instruction is accepted if either part was
+		return ok || functions
+	case 0b00111101:
+		// Analog function group
+		// 00111101 CCCCCCCC VVVVVVVV
+		if len(b) != 3 {
+			return false
+		}
+		m.decoder.setAnalog(b[1], b[2])
+		return true
+	case 0b00111110:
+		// Restricted speed step
+		// 00111110 DxxSSSSS
+		// D: Restriction disabled (1) or enabled (0), S: 28-step speed limit in the same format as 01DCSSSS
+		if len(b) != 2 {
+			return false
+		}
+		m.decoder.speedRestricted = b[1]&0x80 == 0
+		speed := (b[1]&0x0F)<<1 | (b[1]>>4)&1
+		if speed < 4 {
+			speed = 0
+		} else {
+			speed -= 2
+		}
+		m.decoder.speedLimit = speed
+		return true
 	case 0b00111111:
+		// 128-step speed control
 		speed, reverse, ok := m.motionCommand(b)
 		if ok {
-			m.decoder.motor.SetSpeed(speed, reverse)
+			return m.setSpeed(speed, reverse)
 		}
 		return ok
 	default:
@@ -133,19 +180,78 @@ func (m *Message) advancedOperationInstruction(b []byte) bool {
 	}
 }
 
+// functionByte stores eight functions starting at first from one byte, lowest function in bit 0, returning whether
+// any of them applied to us. Functions sent to the consist address are filtered the same way as the function group
+// instructions
+func (m *Message) functionByte(first uint16, b uint8) bool {
+	applied := false
+	for i := range uint16(8) {
+		number := first + i
+		if m.addr == ConsistAddress && !m.decoder.consistFunction(number) {
+			continue
+		}
+		m.decoder.setFunction(number, b&(1<<i) != 0)
+		applied = true
+	}
+	return applied
+}
+
+// setConsist stores a consist address set by a decoder control instruction in CV19, these addresses are
+// always 7 bits so CV20 is cleared. The CV callbacks update our consist address and the motor direction
+func (m *Message) setConsist(cv19 uint8) bool {
+	index := m.cv.IndexPage()
+	return m.cv.IndexedSet(index, 19, cv19) && m.cv.IndexedSet(index, 20, 0)
+}
+
+// setSpeed applies a speed and direction instruction, which only comes from the consist address while we're in
+// a consist. CV19 bit 7 reversing our direction within the consist is handled by the motor
+func (m *Message) setSpeed(speed uint8, reverse bool) bool {
+	if m.addr == DirectAddress && m.decoder.inConsist() {
+		return false
+	}
+	m.decoder.motor.SetSpeed(m.decoder.restrictSpeed(speed), reverse)
+	return true
+}
+
+// speedHeadlight sets FL from the C bit of a 14-step speed instruction once its speed has been accepted.
+// Broadcasts don't carry FL, and on the consist address CV22 filters it like function group one
+func (m *Message) speedHeadlight(b uint8) {
+	if !m.decoder.headlightInSpeed() || m.addr != DirectAddress && m.addr != ConsistAddress || !m.headlightAddressed() {
+		return
+	}
+	m.decoder.callFunction(0, b&0b00010000 != 0)
+}
+
+// restrictSpeed caps a speed step to the restricted speed limit, scaled from 28 steps to the current speed mode.
+// Stop and emergency stop are never changed
+func (d *Decoder) restrictSpeed(speed uint8) uint8 {
+	if !d.speedRestricted || speed < 2 {
+		return speed
+	}
+	var limit int
+	if d.speedLimit >= 2 {
+		limit = int(d.speedLimit-1) * int(d.motor.SpeedMode()) / 28
+	}
+	if limit == 0 {
+		return 0
+	}
+	if int(speed)-1 > limit {
+		return uint8(limit + 1)
+	}
+	return speed
+}
+
 func (m *Message) functionGroupOneInstruction(b uint8) bool {
 	// Function Group One Instruction
 	// 100DDDDD
 	// If message was sent to the consist address, ignore function values according to CVs 21 and 22
-	if m.addr == ConsistAddress {
-		b &= m.decoder.consistFuncMask[0]
+	// FL (F0), unless it's sent with the 14-step speed instruction instead
+	if !m.decoder.headlightInSpeed() && m.headlightAddressed() {
+		m.decoder.setFunction(0, b&(1<<4) != 0)
 	}
-	// FL (F0)
-	m.decoder.callFunction(0, b&(1<<4) != 0)
 	// F1-F4
-	for i := range uint16(4) {
-		m.decoder.callFunction(i+1, b&(1<<i) != 0)
-	}
+	m.functionNibble(1, b, m.decoder.consistFuncMask[0])
+	m.decoder.updateOutputs()
 	return true
 }
 
@@ -159,22 +265,39 @@ func (m *Message) functionGroupTwoInstruction(b uint8) bool {
 		offset = 9
 		mask = m.decoder.consistFuncMask[2]
 	}
-	// If message was sent to the consist address, ignore function values according to CVs 21 and 22
-	if m.addr == ConsistAddress {
-		b &= mask
-	}
+	m.functionNibble(offset, b, mask)
+	m.decoder.updateOutputs()
+	return true
+}
+
+// headlightAddressed reports whether FL in this packet applies to us. On the consist address it's left to our
+// own address unless CV22 enables it for our current direction
+func (m *Message) headlightAddressed() bool {
+	return m.addr != ConsistAddress || m.decoder.consistHeadlight()
+}
+
+// functionNibble stores four functions starting at first from the low bits of b. Functions sent to the consist
+// address are skipped unless enabled in mask from CVs 21 and 22, leaving them to our own address
+func (m *Message) functionNibble(first uint16, b, mask uint8) {
 	for i := range uint16(4) {
-		m.decoder.callFunction(i+offset, b&(1<<i) != 0)
+		if m.addr == ConsistAddress && mask&(1<<i) == 0 {
+			continue
+		}
+		m.decoder.setFunction(i+first, b&(1<<i) != 0)
 	}
-	return true
 }
 
 func (m *Message) functionGroupNInstruction(n uint16, b uint8) bool {
 	// Function Group N Instruction
 	// Each bit in the command byte represents a function (starting with F13)
+	if m.addr == ConsistAddress {
+		// CVs 21 and 22 only cover FL and F1-F12
+		return false
+	}
 	for i := range uint16(8) {
-		m.decoder.callFunction(i+n, b&(1<<i) != 0)
+		m.decoder.setFunction(i+n, b&(1<<i) != 0)
 	}
+	m.decoder.updateOutputs()
 	return true
 }
 
@@ -187,26 +310,67 @@ func (m *Message) featureExpansion(b []byte) bool {
 	// 110GGGGG DDDDDDDD [DDDDDDDD]
 	switch b[0] {
 	case 0b11000000:
-	// Binary state control long form
-	// 32,767 binary states, 0 resets all states to off
-	// 11000000 DLLLLLLL HHHHHHHH
-	// L = 7-bit low byte
-	// H = optional 8-bit high byte (treated as 0 if not present)
-	// D = data bit
-	// TODO: Implement
+		// Binary state control long form
+		// 32,767 binary states, 0 resets all states to off
+		// 11000000 DLLLLLLL HHHHHHHH
+		// L = 7-bit low byte
+		// H = optional 8-bit high byte (treated as 0 if not present)
+		// D = data bit
+		state := uint16(b[1] & 0x7F)
+		if len(b) > 2 {
+			state |= uint16(b[2]) << 7
+		}
+		m.decoder.setBinaryState(state, b[1]&0x80 != 0)
+		return true
 	case 0b11000001:
-	// Model time and date command
-	// Not supported at this time, possibly in the future
+		// Model time and date command
+		if len(b) < 4 {
+			return false
+		}
+		switch b[1] >> 6 {
+		case 0b00:
+			// Model time
+			// 11000001 00MMMMMM WWWHHHHH U0BBBBBB
+			// M = minutes (0-59)
+			// W = weekday (0 = Monday, 6 = Sunday, 7 = not supported)
+			// H = hours (0-23)
+			// U = update, the clock was just set (ignored)
+			// B = acceleration factor (0 = clock stopped)
+			minute, hour := int(b[1]&0x3F), int(b[2]&0x1F)
+			if minute > 59 || hour > 23 {
+				return false
+			}
+			m.decoder.clock.setTime(hour, minute, b[2]>>5, b[3]&0x3F)
+			return true
+		case 0b01:
+			// Model date
+			// 11000001 010TTTTT MMMMYYYY YYYYYYYY
+			// T = day (1-31)
+			// M = month (1-12)
+			// Y = 12-bit year
+			day, month := int(b[1]&0x1F), int(b[2]>>4)
+			if day < 1 || month < 1 || month > 12 || b[1]&0b00100000 != 0 {
+				return false
+			}
+			m.decoder.clock.setDate(int(b[2]&0x0F)<<8|int(b[3]), month, day)
+			return true
+		}
 	case 0b11000010:
-	// System time (0-65535 milliseconds)
-	// Not supported at this time, possibly in the future
+		// System time (0-65535 milliseconds)
+		// 11000010 MMMMMMMM MMMMMMMM
+		if len(b) < 3 {
+			return false
+		}
+		m.decoder.clock.setSystemTime(uint16(b[1])<<8 | uint16(b[2]))
+		return true
 	case 0b11011101:
-	// Binary state control short form
-	// 127 binary states, 0 resets all states to off
-	// 11011101 DLLLLLLL
-	// L = 7-bit low byte
-	// D = data bit
-	// TODO: Implement
+		// Binary state control short form
+		// 127 binary states, 0 resets all states to off
+		// 11011101 DLLLLLLL
+		// L = 7-bit low byte
+		// D = data bit
+		m.decoder.setBinaryState(uint16(b[1]&0x7F), b[1]&0x80 != 0)
+		return true
 	case 0b11011110:
 		// Functions F13-F20
 		return m.functionGroupNInstruction(13, b[1])
@@ -242,7 +406,18 @@ func (m *Message) configVariableAccessInstruction(b []byte) bool {
 	if b[0]&0xF0 == 0xE0 {
 		if l == 3 {
 			// Format is 1110CCAA AAAAAAAA DDDDDDDD
-			return m.cvCommand(m.cv.IndexPage(), b)
+			index := m.cv.IndexPage()
+			write := cvWriteCommand(b)
+			ok := false
+			if !write || m.confirmed() {
+				ok = m.cvCommand(index, b)
+			}
+			// Reads and writes alike are answered with the CV's current value, so writes are only answered once
+			// they've been carried out
+			if !write || m.pendingDone {
+				m.pomReply(index, uint16(b[0]&0b11)<<8|uint16(b[1])+1)
+			}
+			return ok
 		} else if l > 3 {
 			// XPOM - Extended Programming On Main
 			// Up to 8 bytes plus short/long address and checksum (max 11 bytes)
@@ -254,14 +429,14 @@ func (m *Message) configVariableAccessInstruction(b []byte) bool {
 		switch b[0] {
 		case 0b11110010:
 			// CV23 Acceleration rate adjustment
-			return m.cv.Set(23, b[1])
+			return !m.decoderLocked(23) && m.cv.Set(23, b[1])
 		case 0b11110011:
 			// CV24 Deceleration rate adjustment
-			return m.cv.Set(24, b[1])
+			return !m.decoderLocked(24) && m.cv.Set(24, b[1])
 		case 0b11110100:
 			// Extended address programming (CV17, CV18, CV29)
 			// Must receive two identical packets to confirm before setting
-			if l < 3 {
+			if l < 3 || m.decoderLocked(17) {
 				return false
 			}
 			// Check for confirmed values
@@ -302,7 +477,7 @@ func (m *Message) configVariableAccessInstruction(b []byte) bool {
 		case 0b11110110:
 			// Consist extended address
 			// Must receive two identical packets to confirm before setting
-			if l < 3 {
+			if l < 3 || m.decoderLocked(19) {
 				return false
 			}
 			// Check for confirmed values
@@ -315,7 +490,18 @@ func (m *Message) configVariableAccessInstruction(b []byte) bool {
 			}
 		case 0b11111001:
 			// Service Mode Decoder Lock S-9.2.3 Appendix B
-			// Not implemented
+			// 11111001 DDDDDDDD
+			// Sets the lock key in CV15 for every decoder in the loco, only the decoders whose lock ID in CV16
+			// matches can be programmed afterwards
+			// Must receive two identical packets to confirm before setting
+			if l < 2 {
+				return false
+			}
+			if m.cvConfirmCheck(15, b[1]) {
+				return m.cv.SetSync(15, b[1])
+			}
+			// cvConfirmCheck will store the value for the next packet
+			return true
 		}
 	}
 
@@ -73,10 +73,10 @@ func TestExtendedPacket(t *testing.T) {
 		{
 			name: "Feature Expansion",
 			msg: &Message{
-				buf:     []byte{0x03, 0xC0, 0x00, 0xFF},
+				buf:     []byte{0x03, 0xC0, 0x00, 0xFF}, // Binary state long form, clear all states
 				decoder: &Decoder{address: []byte{3}, motor: &motor.Motor{}},
 			},
-			expect: false,
+			expect: true,
 		},
 		{
 			// Long form - Set CV
@@ -94,6 +94,7 @@ func TestExtendedPacket(t *testing.T) {
 				buf:     []byte{0x03, 0xEC, 0x03, 0x01, 0xFF}, // Write 0x01 to CV3
 				cv:      cv.NewMockHandler(true, make(map[uint16]uint8)),
 				decoder: &Decoder{address: []byte{3}, consistAddress: []byte{1}, motor: &motor.Motor{}},
+				pending: []byte{0x03, 0xEC, 0x03, 0x01, 0xFF}, // Confirmation packet already received
 			},
 			expect: true,
 		},
@@ -130,7 +131,7 @@ func TestDecoderConsistControlInstruction(t *testing.T) {
 			name: "Decoder Reset Packet",
 			msg: &Message{
 				addr:    BroadcastAddress,
-				decoder: &Decoder{address: []byte{3}},
+				decoder: &Decoder{address: []byte{3}, motor: &motor.Motor{}},
 			},
 			input:  []byte{0x00},
 			expect: true,
@@ -139,7 +140,7 @@ func TestDecoderConsistControlInstruction(t *testing.T) {
 			name: "Decoder Hard Reset Packet",
 			msg: &Message{
 				cv:      cv.NewMockHandler(true, make(map[uint16]uint8)),
-				decoder: &Decoder{address: []byte{3}},
+				decoder: &Decoder{address: []byte{3}, motor: &motor.Motor{}},
 			},
 			input:  []byte{0x01},
 			expect: true,
@@ -198,6 +199,38 @@ func TestAdvancedOperationInstruction(t *testing.T) {
 			input:  []byte{0x3F, 0x00},
 			expect: true,
 		},
+		{
+			name: "Speed, direction and functions",
+			msg: &Message{
+				decoder: &Decoder{address: []byte{3}, motor: &motor.Motor{}},
+			},
+			input:  []byte{0x3C, 0x80, 0x01, 0x00},
+			expect: true,
+		},
+		{
+			name: "Speed, direction and functions too long",
+			msg: &Message{
+				decoder: &Decoder{address: []byte{3}, motor: &motor.Motor{}},
+			},
+			input:  []byte{0x3C, 0x80, 0x01, 0x00, 0x00, 0x00, 0x00},
+			expect: false,
+		},
+		{
+			name: "Analog function group",
+			msg: &Message{
+				decoder: &Decoder{address: []byte{3}, motor: &motor.Motor{}},
+			},
+			input:  []byte{0x3D, 0x01, 0x40},
+			expect: true,
+		},
+		{
+			name: "Restricted speed step",
+			msg: &Message{
+				decoder: &Decoder{address: []byte{3}, motor: &motor.Motor{}},
+			},
+			input:  []byte{0x3E, 0x18},
+			expect: true,
+		},
 		{
 			name: "Invalid command",
 			msg: &Message{
@@ -301,6 +334,22 @@ func TestFeatureExpansion(t *testing.T) {
 			input:  []byte{0xDC, 0x01},
 			expect: true,
 		},
+		{
+			name: "Binary state short form",
+			msg: &Message{
+				decoder: &Decoder{address: []byte{3}, motor: &motor.Motor{}},
+			},
+			input:  []byte{0xDD, 0x85},
+			expect: true,
+		},
+		{
+			name: "Binary state long form",
+			msg: &Message{
+				decoder: &Decoder{address: []byte{3}, motor: &motor.Motor{}},
+			},
+			input:  []byte{0xC0, 0x85, 0x01},
+			expect: true,
+		},
 		{
 			name: "Invalid command",
 			msg: &Message{
@@ -425,3 +474,291 @@ func TestConfigVariableAccessInstruction(t *testing.T) {
 		})
 	}
 }
+
+func TestXPOMWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		index  uint16
+		// Expected value of each CV in the index page after the write
+		expect map[uint16]uint8
+	}{
+		{
+			name:   "Write bytes",
+			packet: withChecksum(0x03, 0xEC, 0, 0, 44, 7, 8),
+			expect: map[uint16]uint8{45: 7, 46: 8},
+		},
+		{
+			name:   "Write bytes past the last CV",
+			packet: withChecksum(0x03, 0xEC, 0, 0, 44, 7, 8, 9),
+			expect: map[uint16]uint8{45: 0, 46: 0},
+		},
+		{
+			name:   "Write bit",
+			packet: withChecksum(0x03, 0xE8, 0, 0, 44, 0b11111010),
+			expect: map[uint16]uint8{45: 0b100, 46: 0},
+		},
+		{
+			name:   "Write bytes in an index page that isn't selected",
+			packet: withChecksum(0x03, 0xEC, 16, 1, 0, 7, 8),
+			index:  cv.FunctionMapReversePage,
+			expect: map[uint16]uint8{257: 7, 258: 8},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, set := newIndexedTestDecoder(t)
+			for cvNumber := range tt.expect {
+				set(tt.index, cvNumber, 0)
+			}
+			// Leave page 0 selected, so the write has to carry its own index page
+			set(0, 31, 0)
+			msg := NewMessage(d.cv, d)
+
+			processPackets(msg, tt.packet, tt.packet)
+			for cvNumber, want := range tt.expect {
+				if got := d.cv.IndexedCV(tt.index, cvNumber); got != want {
+					t.Errorf("CV%d in index page %d = %d, want %d", cvNumber, tt.index, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConsistControl(t *testing.T) {
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 29: 0b00000010})
+	msg := NewMessage(d.cv, d)
+
+	speed := func(t *testing.T, addr, step byte) {
+		t.Helper()
+		processPackets(msg, withChecksum(addr, 0x3F, step))
+	}
+	expect := func(t *testing.T, step uint8, dir motor.Direction) {
+		t.Helper()
+		if got := d.motor.TargetSpeed(); got != step {
+			t.Errorf("target speed = %d, want %d", got, step)
+		}
+		if got := d.motor.TargetDirection(); got != dir {
+			t.Errorf("target direction = %v, want %v", got, dir)
+		}
+	}
+
+	// Not in a consist, our own throttle is obeyed
+	speed(t, 3, 0x80|20)
+	expect(t, 20, motor.Forward)
+
+	// Join consist 10 in reverse
+	processPackets(msg, withChecksum(0x03, 0x13, 10))
+	if d.cv.CV(19) != 0x80|10 {
+		t.Fatalf("CV19 = %#x, want %#x", d.cv.CV(19), 0x80|10)
+	}
+
+	t.Run("Base address speed ignored", func(t *testing.T) {
+		// We're now running backwards relative to the consist
+		speed(t, 3, 0x80|50)
+		expect(t, 20, motor.Reverse)
+		// 28-step speed and direction instruction too
+		processPackets(msg, withChecksum(0x03, 0b01111111))
+		expect(t, 20, motor.Reverse)
+	})
+
+	t.Run("Consist address speed reversed", func(t *testing.T) {
+		speed(t, 10, 0x80|40)
+		expect(t, 40, motor.Reverse)
+		speed(t, 10, 40)
+		if got := d.motor.TargetDirection(); got != motor.Forward {
+			t.Errorf("target direction = %v, want Forward", got)
+		}
+	})
+
+	t.Run("Function group N ignored on consist address", func(t *testing.T) {
+		m := &Message{addr: ConsistAddress, decoder: d}
+		if m.functionGroupNInstruction(13, 0x01) {
+			t.Errorf("F13-F20 accepted on consist address")
+		}
+	})
+
+	t.Run("Leave consist", func(t *testing.T) {
+		processPackets(msg, withChecksum(0x03, 0x12, 0))
+		speed(t, 3, 0x80|60)
+		expect(t, 60, motor.Forward)
+		speed(t, 10, 0x80|5)
+		expect(t, 60, motor.Forward)
+	})
+
+	t.Run("Long consist address from CV19/20", func(t *testing.T) {
+		// CV20 = 2, CV19 = 34 gives address 234
+		d.cv.IndexedSet(0, 20, 2)
+		d.cv.IndexedSet(0, 19, 34)
+		speed(t, 3, 0x80|70)
+		expect(t, 60, motor.Forward)
+		processPackets(msg, withChecksum(0xC0, 234, 0x3F, 0x80|70))
+		expect(t, 70, motor.Forward)
+	})
+}
+
+func TestConsistFunctions(t *testing.T) {
+	tests := []struct {
+		name   string
+		cv21   uint8
+		cv22   uint8
+		expect [13]bool
+	}{
+		{
+			name:   "Nothing enabled",
+			expect: [13]bool{1: true, 4: true, 5: true, 12: true},
+		},
+		{
+			name:   "F1 and F5 enabled",
+			cv21:   0b00010001,
+			expect: [13]bool{4: true, 12: true},
+		},
+		{
+			name:   "F12 enabled",
+			cv22:   0b00100000,
+			expect: [13]bool{1: true, 4: true, 5: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 19: 10, 21: tt.cv21, 22: tt.cv22, 29: 0b10})
+			msg := NewMessage(d.cv, d)
+
+			// F1, F4, F5 and F12 on from our own address, then everything off from the consist address
+			processPackets(msg, withChecksum(3, 0b10001001), withChecksum(3, 0b10110001), withChecksum(3, 0b10101000))
+			processPackets(msg, withChecksum(10, 0b10000000), withChecksum(10, 0b10110000), withChecksum(10, 0b10100000))
+			for i, want := range tt.expect {
+				if got := d.Function(uint16(i)); got != want {
+					t.Errorf("F%d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConsistHeadlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		cv22    uint8
+		reverse bool
+		expect  bool
+	}{
+		{name: "FLf forward", cv22: 0b01, expect: true},
+		{name: "FLf reverse", cv22: 0b01, reverse: true, expect: false},
+		{name: "FLr forward", cv22: 0b10, expect: false},
+		{name: "FLr reverse", cv22: 0b10, reverse: true, expect: true},
+		{name: "Middle unit", cv22: 0b00, expect: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// CV29 bit 0 reverses our normal direction, standing in for running in reverse
+			cv29 := uint8(0b00000010)
+			if tt.reverse {
+				cv29 |= 1
+			}
+			d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 19: 10, 22: tt.cv22, 29: cv29, 33: 0b01, 34: 0b01})
+			msg := NewMessage(d.cv, d)
+
+			var lamp bool
+			d.RegisterOutput("lampFront", func(_ uint16, on bool) { lamp = on })
+
+			// FL on, sent to the consist address
+			processPackets(msg, withChecksum(10, 0x90))
+			if lamp != tt.expect {
+				t.Errorf("lamp = %v, want %v", lamp, tt.expect)
+			}
+
+			// The base address always controls FL
+			processPackets(msg, withChecksum(3, 0x90))
+			if !lamp {
+				t.Errorf("lamp off after FL sent to base address")
+			}
+
+			// FL off from the consist address only applies where it's enabled, otherwise it's left on
+			processPackets(msg, withChecksum(10, 0x80))
+			if lamp != !tt.expect {
+				t.Errorf("lamp = %v after FL off sent to consist address, want %v", lamp, !tt.expect)
+			}
+		})
+	}
+}
+
+func TestSpeedDirectionFunctions(t *testing.T) {
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 22: 0b01, 29: 0b10, 33: 0b01, 35: 0b10})
+	msg := NewMessage(d.cv, d)
+
+	var front, rear bool
+	d.RegisterOutput("lampFront", func(_ uint16, on bool) { front = on })
+	d.RegisterOutput("lampRear", func(_ uint16, on bool) { rear = on })
+
+	// Forward at step 50 with FL and F1 on
+	processPackets(msg, withChecksum(3, 0x3C, 0x80|50, 0b11))
+	if got := d.motor.TargetSpeed(); got != 50 {
+		t.Errorf("speed = %d, want 50", got)
+	}
+	if !front || !rear {
+		t.Errorf("front = %v, rear = %v, want both on", front, rear)
+	}
+
+	// Without function bytes only the speed changes
+	processPackets(msg, withChecksum(3, 0x3C, 0x80|20))
+	if got := d.motor.TargetSpeed(); got != 20 || !front || !rear {
+		t.Errorf("speed = %d, front = %v, rear = %v after speed only", got, front, rear)
+	}
+
+	// On the consist address CV21/22 filter the functions, leaving the rest to the base address
+	processPackets(msg, withChecksum(3, 0x12, 10))
+	processPackets(msg, withChecksum(10, 0x3C, 0x80|40, 0b00))
+	if got := d.motor.TargetSpeed(); got != 40 || front || !rear {
+		t.Errorf("speed = %d, front = %v, rear = %v from consist address", got, front, rear)
+	}
+
+	// The base address speed is ignored, but its functions still apply
+	m := &Message{addr: DirectAddress, decoder: d}
+	if !m.advancedOperationInstruction([]byte{0x3C, 0x80 | 60, 0b11}) {
+		t.Errorf("functions from base address rejected while consisted")
+	}
+	if got := d.motor.TargetSpeed(); got != 40 || !front || !rear {
+		t.Errorf("speed = %d, front = %v, rear = %v from base address while consisted", got, front, rear)
+	}
+	if m.advancedOperationInstruction([]byte{0x3C, 0x80 | 60}) {
+		t.Errorf("speed only from base address accepted while consisted")
+	}
+}
+
+func TestRestrictedSpeed(t *testing.T) {
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 29: 0b10})
+	msg := NewMessage(d.cv, d)
+
+	// Restrict to 28-step speed 14, half speed
+	processPackets(msg, withChecksum(3, 0x3E, 0x18))
+
+	tests := []struct {
+		name   string
+		input  []byte
+		expect uint8
+	}{
+		{name: "128-step below limit", input: []byte{3, 0x3F, 0x80 | 40}, expect: 40},
+		{name: "128-step above limit", input: []byte{3, 0x3F, 0x80 | 100}, expect: 64},
+		{name: "28-step above limit", input: []byte{3, 0x7F}, expect: 15},
+		{name: "Emergency stop", input: []byte{3, 0x3F, 0x81}, expect: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processPackets(msg, withChecksum(tt.input...))
+			if got := d.motor.TargetSpeed(); got != tt.expect {
+				t.Errorf("speed = %d, want %d", got, tt.expect)
+			}
+		})
+	}
+
+	// Clearing the restriction allows full speed again
+	processPackets(msg, withChecksum(3, 0x3E, 0x80))
+	processPackets(msg, withChecksum(3, 0x3F, 0x80|100))
+	if got := d.motor.TargetSpeed(); got != 100 {
+		t.Errorf("speed = %d after restriction cleared, want 100", got)
+	}
+}
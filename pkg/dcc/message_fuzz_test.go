@@ -24,7 +24,9 @@ func FuzzMessage(f *testing.F) {
 			return
 		}
 
-		m := NewMessage(cv.NewMockHandler(true, make(map[uint16]uint8)), &Decoder{
+		mockCV := cv.NewMockHandler(true, make(map[uint16]uint8))
+		m := NewMessage(mockCV, &Decoder{
+			cv:             mockCV,
 			address:        []byte{3},
 			consistAddress: []byte{1},
 			motor:          &motor.Motor{},
@@ -1,28 +1,134 @@
 package dcc
 
-func (m *Message) serviceModePacket(b []byte) bool {
-	m.decoder.SetOpMode(ServiceMode)
-	/* TODO: Implement the ability to leave service mode
-	For now, service mode is hotel california. We'll depend on losing power to return to operations mode
-	if time.Now().Sub(m.decoder.lastSvcResetTime) > 20*time.Millisecond {
-		// If it's been more than 20ms since the last reset packet, service mode is no longer ready, back to operations mode
-		// Check to ensure we didn't receive a service mode packet before switching back to operations mode per S-9.2.3C
-		//m.decoder.SetOpMode(UndefinedMode)
-		return
-	} */
+import "time"
+
+// updateOpMode is the service mode state machine from S-9.2.3. Service mode is entered when a service
+// mode packet arrives within 20ms of a reset packet, and left when any other packet arrives after the
+// 20ms window following the last reset packet has closed
+func (m *Message) updateOpMode() {
+	d := m.decoder
+	inWindow := time.Since(d.lastSvcResetTime) <= svcModeWindow
+
+	switch {
+	case m.isResetPacket():
+		// Reset packets re-arm the window through Decoder.Reset and never end service mode
+	case m.isServicePacket():
+		if d.opMode == ServiceMode {
+			return
+		}
+		if d.svcModeReady && inWindow {
+			d.SetOpMode(ServiceMode)
+		} else {
+			// Outside the reset window this is an operations mode packet for one of addresses 112-127
+			d.SetOpMode(OperationsMode)
+		}
+	default:
+		if d.opMode == ServiceMode && inWindow {
+			// Stay in service mode until the window following the last reset packet has closed
+			return
+		}
+		d.SetOpMode(OperationsMode)
+	}
+}
 
+// isResetPacket checks for the digital decoder reset packet: 00000000 00000000 00000000
+func (m *Message) isResetPacket() bool {
+	return len(m.buf) == 3 && m.buf[0] == 0 && m.buf[1] == 0
+}
+
+// isServicePacket checks for the 3 or 4 byte 0111xxxx service mode packet formats
+func (m *Message) isServicePacket() bool {
+	return (len(m.buf) == 3 || len(m.buf) == 4) && m.buf[0]&0b11110000 == 0b01110000
+}
+
+func (m *Message) serviceModePacket(b []byte) bool {
 	ack := false
 
-	// Direct CV Addressing commands
-	// 0111CCAA AAAAAAAA DDDDDDDD EEEEEEEE
-	if b[0]&0b11110000 == 0b01110000 {
-		// CV access/programming command
+	if b[0]&0b11110000 != 0b01110000 {
+		return false
+	}
+
+	switch len(b) {
+	case 4:
+		// Direct CV Addressing commands
+		// 0111CCAA AAAAAAAA DDDDDDDD EEEEEEEE
+		if cvWriteCommand(b) && !m.confirmed() {
+			return false
+		}
 		ack = m.cvCommand(m.cv.IndexPage(), b)
+	case 3:
+		// Paged, Register and Physical Register Addressing commands
+		// 0111CRRR DDDDDDDD EEEEEEEE
+		if b[0]&0b1000 != 0 && !m.confirmed() {
+			return false
+		}
+		ack = m.registerCommand(b)
 	}
 
 	return ack
 }
 
+// registerCommand handles the register based service mode addressing methods. Paged and Physical
+// Register addressing share the packet format, Physical Register mode is just Paged mode with the
+// page register left at its default of 1
+func (m *Message) registerCommand(b []byte) bool {
+	// C: 0 = verify, 1 = write
+	// R: register number - 1
+	// 0111CRRR DDDDDDDD
+	write := b[0]&0b1000 != 0
+	reg := uint16(b[0]&0b111) + 1
+	data := b[1]
+
+	var cvNum uint16
+	switch reg {
+	case 1, 2, 3, 4:
+		// Paged data registers, page 0 wraps around to the last page (CV1021-1024)
+		page := uint16(m.decoder.pageRegister)
+		if page == 0 {
+			page = 256
+		}
+		cvNum = (page-1)*4 + reg
+	case 5:
+		// Basic configuration register
+		cvNum = 29
+	case 6:
+		// Page register, only held in RAM so it survives the reset packets sent between each step
+		if write {
+			m.decoder.pageRegister = data
+			return true
+		}
+		return m.decoder.pageRegister == data
+	case 7, 8:
+		// Version number and manufacturer ID registers
+		cvNum = reg
+	}
+
+	// Translate to the equivalent Direct CV Addressing command
+	op := byte(0b01)
+	if write {
+		op = 0b11
+	}
+	cvNum--
+	return m.cvCommand(m.cv.IndexPage(), []byte{0b01110000 | op<<2 | byte(cvNum>>8), byte(cvNum), data})
+}
+
+// cvWriteCommand checks whether a CV programming command modifies the CV (byte write or bit write)
+func cvWriteCommand(b []byte) bool {
+	switch (b[0] >> 2) & 0b11 {
+	case 0b11:
+		return true
+	case 0b10:
+		return b[2]&0b11110000 == 0b11110000
+	}
+	return false
+}
+
+// decoderLocked checks the decoder lock, which only lets us be programmed while the key in CV15 matches our lock ID
+// in CV16. CV15 itself can always be written so the lock can be released
+func (m *Message) decoderLocked(cvNum uint16) bool {
+	return cvNum != 15 && m.cv.CV(15) != m.cv.CV(16)
+}
+
 func (m *Message) cvCommand(index uint16, b []byte) bool {
 	// CV programming command format
 	// C = command type, A = address, D = data
@@ -39,6 +145,11 @@ func (m *Message) cvCommand(index uint16, b []byte) bool {
 	cvNum := uint16(b[0]&0b11)<<8 | uint16(b[1]) + 1 // AA AAAAAAAA (n-1, CV1 = 0)
 	data := b[2]                                     // DDDDDDDD
 
+	// While locked we don't answer service mode at all, leaving the acks to the other decoders in the loco
+	if m.decoderLocked(cvNum) && (cvWriteCommand(b) || m.decoder.opMode == ServiceMode) {
+		return false
+	}
+
 	ack := false
 	switch op {
 	case 0b01:
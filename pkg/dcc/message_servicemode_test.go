@@ -79,3 +79,286 @@ func TestSetCVCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestRegisterCommand(t *testing.T) {
+	cvs := testCVConfirm([]uint16{1, 2, 7, 8, 29, 1021}, []uint8{3, 10, 42, 13, 0b00000110, 0x55})
+	tests := []struct {
+		name       string
+		buf        []byte
+		page       uint8
+		mockCV     cv.Handler
+		expect     bool
+		expectPage uint8
+	}{
+		{
+			name:       "Physical register verify address",
+			buf:        []byte{0b01110000, 3, 0}, // verify reg 1 == 3
+			page:       1,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     true,
+			expectPage: 1,
+		},
+		{
+			name:       "Physical register verify mismatch",
+			buf:        []byte{0b01110001, 11, 0}, // verify reg 2 == 11
+			page:       1,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     false,
+			expectPage: 1,
+		},
+		{
+			name:       "Paged verify CV7",
+			buf:        []byte{0b01110010, 42, 0}, // verify reg 3 (page 2) == 42
+			page:       2,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     true,
+			expectPage: 2,
+		},
+		{
+			name:       "Paged verify page 0 wraps to CV1021",
+			buf:        []byte{0b01110000, 0x55, 0}, // verify reg 1 (page 0) == 0x55
+			page:       0,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     true,
+			expectPage: 0,
+		},
+		{
+			name:       "Paged write",
+			buf:        []byte{0b01111001, 20, 0}, // write reg 2 = 20
+			page:       1,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     true,
+			expectPage: 1,
+		},
+		{
+			name:       "Paged write failure",
+			buf:        []byte{0b01111001, 20, 0}, // write reg 2 = 20
+			page:       1,
+			mockCV:     cv.NewMockHandler(false, cvs),
+			expect:     false,
+			expectPage: 1,
+		},
+		{
+			name:       "Register 5 verifies CV29",
+			buf:        []byte{0b01110100, 0b00000110, 0},
+			page:       1,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     true,
+			expectPage: 1,
+		},
+		{
+			name:       "Page register write",
+			buf:        []byte{0b01111101, 5, 0}, // write reg 6 = 5
+			page:       1,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     true,
+			expectPage: 5,
+		},
+		{
+			name:       "Page register verify",
+			buf:        []byte{0b01110101, 5, 0}, // verify reg 6 == 5
+			page:       5,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     true,
+			expectPage: 5,
+		},
+		{
+			name:       "Page register verify mismatch",
+			buf:        []byte{0b01110101, 4, 0}, // verify reg 6 == 4
+			page:       5,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     false,
+			expectPage: 5,
+		},
+		{
+			name:       "Register 7 verifies version number",
+			buf:        []byte{0b01110110, 42, 0},
+			page:       3,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     true,
+			expectPage: 3,
+		},
+		{
+			name:       "Register 8 verifies manufacturer ID",
+			buf:        []byte{0b01110111, 13, 0},
+			page:       3,
+			mockCV:     cv.NewMockHandler(true, cvs),
+			expect:     true,
+			expectPage: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Writes are confirmed by a duplicate packet, which is covered by TestWriteConfirmation
+			m := &Message{buf: tt.buf, cv: tt.mockCV, decoder: &Decoder{pageRegister: tt.page}, pending: tt.buf}
+			got := m.serviceModePacket(tt.buf)
+			if got != tt.expect {
+				t.Errorf("serviceModePacket() = %v, want %v", got, tt.expect)
+			}
+			if m.decoder.pageRegister != tt.expectPage {
+				t.Errorf("pageRegister = %d, want %d", m.decoder.pageRegister, tt.expectPage)
+			}
+		})
+	}
+}
+
+func TestServiceModeStateMachine(t *testing.T) {
+	reset := []byte{0x00, 0x00, 0x00}
+	idle := []byte{0xFF, 0x00, 0xFF}
+	verify := []byte{0b01110100, 0x00, 0x03, 0b01110100 ^ 0x03} // Verify CV1 == 3
+	headlight := []byte{0x03, 0x90, 0x03 ^ 0x90}                // F0 on
+
+	// A nil packet stands in for the 20ms service mode window closing
+	tests := []struct {
+		name          string
+		packets       [][]byte
+		expectMode    opMode
+		expectReady   bool
+		expectService bool
+		expectLight   bool
+	}{
+		{
+			name:          "Reset then service packet enters service mode",
+			packets:       [][]byte{reset, verify},
+			expectMode:    ServiceMode,
+			expectReady:   true,
+			expectService: true,
+		},
+		{
+			name:       "Service packet without reset is an operations mode packet",
+			packets:    [][]byte{verify},
+			expectMode: OperationsMode,
+		},
+		{
+			name:       "Service packet after the window is an operations mode packet",
+			packets:    [][]byte{reset, nil, verify},
+			expectMode: OperationsMode,
+		},
+		{
+			name:       "Operations packet after reset closes the window",
+			packets:    [][]byte{reset, idle, verify},
+			expectMode: OperationsMode,
+		},
+		{
+			name:        "Non-service packet within the window stays in service mode",
+			packets:     [][]byte{reset, verify, idle},
+			expectMode:  ServiceMode,
+			expectReady: true,
+		},
+		{
+			name:        "Reset packet after the window stays in service mode",
+			packets:     [][]byte{reset, verify, nil, reset},
+			expectMode:  ServiceMode,
+			expectReady: true,
+		},
+		{
+			name:       "Idle packet after the window exits service mode",
+			packets:    [][]byte{reset, verify, nil, idle},
+			expectMode: OperationsMode,
+		},
+		{
+			name:        "Function packet after the window exits service mode and is processed",
+			packets:     [][]byte{reset, verify, nil, headlight},
+			expectMode:  OperationsMode,
+			expectLight: true,
+		},
+		{
+			name:        "Function packet within the window is ignored",
+			packets:     [][]byte{reset, verify, headlight},
+			expectMode:  ServiceMode,
+			expectReady: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 29: 0b00000010, 33: 0b00000001})
+			msg := NewMessage(d.cv, d)
+
+			light := false
+			d.RegisterOutput("lampFront", func(index uint16, on bool) {
+				light = on
+			})
+
+			inService := false
+			for _, p := range tt.packets {
+				if p == nil {
+					d.lastSvcResetTime = d.lastSvcResetTime.Add(-2 * svcModeWindow)
+					continue
+				}
+				msg.AddBytes(p)
+				msg.Process()
+				inService = msg.msgType == ServiceMsg
+				msg.Reset()
+			}
+
+			if d.opMode != tt.expectMode {
+				t.Errorf("opMode = %d, want %d", d.opMode, tt.expectMode)
+			}
+			if d.svcModeReady != tt.expectReady {
+				t.Errorf("svcModeReady = %t, want %t", d.svcModeReady, tt.expectReady)
+			}
+			if tt.expectService && !inService {
+				t.Errorf("last packet was not handled as a service mode packet")
+			}
+			if light != tt.expectLight {
+				t.Errorf("headlight = %t, want %t", light, tt.expectLight)
+			}
+		})
+	}
+}
+
+func TestDecoderLock(t *testing.T) {
+	verify := []byte{0b0100, 9, 0}   // Verify CV10 == 0
+	write := []byte{0b1100, 9, 0x42} // Write 0x42 to CV10
+	unlock := []byte{0b1100, 14, 2}  // Write 2 to CV15
+
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 15: 1, 16: 2})
+	m := NewMessage(d.cv, d)
+
+	d.opMode = ServiceMode
+	if m.cvCommand(0, verify) {
+		t.Errorf("locked decoder answered a service mode verify")
+	}
+	if m.cvCommand(0, write) {
+		t.Errorf("locked decoder accepted a service mode write")
+	}
+
+	d.opMode = OperationsMode
+	if !m.cvCommand(0, verify) {
+		t.Errorf("locked decoder didn't answer an operations mode verify")
+	}
+	if m.cvCommand(0, write) || d.cv.CV(10) != 0 {
+		t.Errorf("locked decoder accepted an operations mode write")
+	}
+	// Short form writes are locked too
+	processPackets(m, withChecksum(0x03, 0xF2, 20))
+	if d.cv.CV(23) != 0 {
+		t.Errorf("locked decoder accepted a CV23 adjustment")
+	}
+
+	// CV15 can always be written to release the lock
+	d.opMode = ServiceMode
+	if !m.cvCommand(0, unlock) || d.cv.CV(15) != 2 {
+		t.Fatalf("CV15 write rejected while locked")
+	}
+	if !m.cvCommand(0, write) || d.cv.CV(10) != 0x42 {
+		t.Errorf("unlocked decoder rejected a write")
+	}
+
+	// The lock instruction sets CV15 once confirmed
+	d.opMode = OperationsMode
+	lock := withChecksum(0x03, 0b11111001, 5)
+	processPackets(m, lock)
+	if d.cv.CV(15) != 2 {
+		t.Errorf("lock instruction applied without confirmation")
+	}
+	processPackets(m, lock)
+	if d.cv.CV(15) != 5 {
+		t.Errorf("CV15 = %d after lock instruction, want 5", d.cv.CV(15))
+	}
+	if m.cvCommand(0, write) {
+		t.Errorf("decoder accepted a write after the lock instruction")
+	}
+}
@@ -198,6 +198,11 @@ func TestAddressMatch(t *testing.T) {
 			address: []byte{0x01, 0x02, 0x03, 0x04},
 			want:    false,
 		},
+		{
+			name:    "Empty address",
+			address: []byte{},
+			want:    false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -215,6 +220,7 @@ func TestMessageType(t *testing.T) {
 		buffer       []byte
 		opMode       opMode
 		svcModeReady bool
+		accessory    bool
 		expectedType MessageType
 	}{
 		{
@@ -261,11 +267,19 @@ func TestMessageType(t *testing.T) {
 		},
 		{
 			name:         "Unknown message type",
-			buffer:       []byte{0x80}, // Accessory decoder (not implemented)
+			buffer:       []byte{0x80}, // Accessory decoder packet in multi-function mode
 			opMode:       OperationsMode,
 			svcModeReady: false,
 			expectedType: UnknownMsg,
 		},
+		{
+			name:         "Accessory decoder packet",
+			buffer:       []byte{0x80},
+			opMode:       OperationsMode,
+			svcModeReady: false,
+			accessory:    true,
+			expectedType: AccessoryMsg,
+		},
 	}
 
 	for _, tt := range tests {
@@ -274,6 +288,7 @@ func TestMessageType(t *testing.T) {
 				motor:        &motor.Motor{},
 				opMode:       tt.opMode,
 				svcModeReady: tt.svcModeReady,
+				accessory:    tt.accessory,
 			}
 			msg := NewMessage(nil, decoder)
 			msg.AddBytes(tt.buffer)
@@ -544,3 +559,200 @@ func TestMotionCommand_SpeedMode128(t *testing.T) {
 		}
 	}
 }
+
+// withChecksum appends the error detection byte to a packet
+func withChecksum(b ...byte) []byte {
+	var xor byte
+	for _, v := range b {
+		xor ^= v
+	}
+	return append(b, xor)
+}
+
+// TestMotionCommand_Headlight tests FL following CV29 bit 1 between the 14-step speed instruction and function group one
+func TestMotionCommand_Headlight(t *testing.T) {
+	tests := []struct {
+		name   string
+		cv29   uint8
+		lampOn bool
+		input  []byte
+		expect bool
+	}{
+		{name: "14-step C bit on", cv29: 0b00, input: []byte{3, 0x70}, expect: true},
+		{name: "14-step C bit off", cv29: 0b00, lampOn: true, input: []byte{3, 0x60}, expect: false},
+		{name: "14-step function group one ignored", cv29: 0b00, input: []byte{3, 0x90}, expect: false},
+		{name: "14-step broadcast stop", cv29: 0b00, lampOn: true, input: []byte{0, 0x60}, expect: true},
+		{name: "28-step C bit is speed", cv29: 0b10, input: []byte{3, 0x70}, expect: false},
+		{name: "28-step function group one", cv29: 0b10, input: []byte{3, 0x90}, expect: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 29: tt.cv29, 33: 0b01})
+			msg := NewMessage(d.cv, d)
+
+			var lamp bool
+			d.RegisterOutput("lampFront", func(_ uint16, on bool) { lamp = on })
+			if tt.lampOn {
+				processPackets(msg, withChecksum(3, 0x70))
+			}
+
+			processPackets(msg, withChecksum(tt.input...))
+			if lamp != tt.expect {
+				t.Errorf("lamp = %v, want %v", lamp, tt.expect)
+			}
+		})
+	}
+}
+
+func TestMotionCommand_HeadlightConsisted(t *testing.T) {
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 19: 10, 22: 0b01, 29: 0b00, 33: 0b01})
+	msg := NewMessage(d.cv, d)
+
+	var lamp bool
+	d.RegisterOutput("lampFront", func(_ uint16, on bool) { lamp = on })
+
+	// The consist address speed carries FL where CV22 enables it
+	processPackets(msg, withChecksum(10, 0x70))
+	if !lamp {
+		t.Errorf("lamp off after C bit on sent to consist address")
+	}
+
+	// Our own address speed is ignored while consisted, and so is its C bit
+	processPackets(msg, withChecksum(3, 0x60))
+	if !lamp {
+		t.Errorf("lamp off after a rejected speed instruction")
+	}
+}
+
+func TestWriteConfirmation(t *testing.T) {
+	reset := withChecksum(0x00, 0x00)
+	idle := withChecksum(0xFF, 0x00)
+	opsWrite := withChecksum(0x03, 0xEC, 0x02, 0x2A)          // Write 42 to CV3
+	otherLoco := withChecksum(0x04, 0x90)                     // F0 on, address 4
+	ourFunction := withChecksum(0x03, 0x90)                   // F0 on, address 3
+	svcWrite := withChecksum(0b01111100, 0x02, 0x2A)          // Direct mode write 42 to CV3
+	svcBitWrite := withChecksum(0b01111000, 0x02, 0b11111101) // Direct mode write bit 5 of CV3 to 1
+	regWrite := withChecksum(0b01111010, 0x2A)                // Register mode write 42 to register 3
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		expect  uint8
+	}{
+		{
+			name:    "Ops mode single write ignored",
+			packets: [][]byte{opsWrite},
+			expect:  0,
+		},
+		{
+			name:    "Ops mode confirmed write",
+			packets: [][]byte{opsWrite, opsWrite},
+			expect:  42,
+		},
+		{
+			name:    "Ops mode write invalidated by packet to our address",
+			packets: [][]byte{opsWrite, ourFunction, opsWrite},
+			expect:  0,
+		},
+		{
+			name:    "Ops mode write not invalidated by packet to another address",
+			packets: [][]byte{opsWrite, otherLoco, opsWrite},
+			expect:  42,
+		},
+		{
+			name:    "Ops mode write not invalidated by idle packet",
+			packets: [][]byte{opsWrite, idle, opsWrite},
+			expect:  42,
+		},
+		{
+			name:    "Service mode single write ignored",
+			packets: [][]byte{reset, svcWrite},
+			expect:  0,
+		},
+		{
+			name:    "Service mode confirmed write",
+			packets: [][]byte{reset, svcWrite, svcWrite},
+			expect:  42,
+		},
+		{
+			name:    "Service mode write invalidated by reset packet",
+			packets: [][]byte{reset, svcWrite, reset, svcWrite},
+			expect:  0,
+		},
+		{
+			name:    "Service mode single bit write ignored",
+			packets: [][]byte{reset, svcBitWrite},
+			expect:  0,
+		},
+		{
+			name:    "Service mode confirmed bit write",
+			packets: [][]byte{reset, svcBitWrite, svcBitWrite},
+			expect:  0b00100000,
+		},
+		{
+			name:    "Register mode confirmed write",
+			packets: [][]byte{reset, regWrite, regWrite},
+			expect:  42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 3: 0, 29: 0b00000010})
+			msg := NewMessage(d.cv, d)
+
+			for _, p := range tt.packets {
+				msg.AddBytes(p)
+				msg.Process()
+				msg.Reset()
+			}
+
+			if got := d.cv.CV(3); got != tt.expect {
+				t.Errorf("CV3 = %d, want %d", got, tt.expect)
+			}
+		})
+	}
+}
+
+// TestWriteRepeats tests that a confirmed write is only carried out once however many times it's repeated
+func TestWriteRepeats(t *testing.T) {
+	opsWrite := withChecksum(0x03, 0xEC, 0x02, 0x2A) // Write 42 to CV3
+	ourFunction := withChecksum(0x03, 0x90)          // F0 on, address 3
+
+	tests := []struct {
+		name    string
+		packets [][]byte
+		expect  int
+	}{
+		{
+			name:    "Five repeats",
+			packets: [][]byte{opsWrite, opsWrite, opsWrite, opsWrite, opsWrite},
+			expect:  1,
+		},
+		{
+			name:    "Repeats after another packet",
+			packets: [][]byte{opsWrite, opsWrite, opsWrite, ourFunction, opsWrite, opsWrite, opsWrite},
+			expect:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 3: 0, 29: 0b00000010})
+			msg := NewMessage(d.cv, d)
+
+			writes := 0
+			d.cv.RegisterCallback(3, func(uint16, uint8) bool {
+				writes++
+				return true
+			})
+			writes = 0
+
+			processPackets(msg, tt.packets...)
+			if writes != tt.expect {
+				t.Errorf("CV3 written %d times, want %d", writes, tt.expect)
+			}
+		})
+	}
+}
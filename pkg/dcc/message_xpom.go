@@ -1,5 +1,7 @@
 package dcc
 
+import "github.com/mikesmitty/rp24-dcc-decoder/pkg/railcom"
+
 func (m *Message) handleXPOM(b []byte) bool {
 	// XPOM - Extended Programming On Main
 	// Up to 8 bytes plus short/long address and checksum (max 11 bytes)
@@ -15,24 +17,21 @@ func (m *Message) handleXPOM(b []byte) bool {
 		return false
 	}
 
-	// Check for identical packets
-	match := false
-	if len(b) == len(m.lastXPOM) {
-		match = true
-		for i, v := range b {
-			if v != m.lastXPOM[i] {
-				match = false
-				break
-			}
-		}
+	// Wait for the second identical packet before changing anything, reads are answered straight away. Repeats of
+	// a write that's been carried out are only answered
+	op := (b[0] >> 2) & 0b11
+	// The sequence number is sent back with the reply so the command station can match them up
+	seq := b[0] & 0b11
+	// The index page comes with the command rather than from CV31/32, and the CV number is sent as n-1
+	index := m.cv.IndexPage(b[1], b[2])
+	first := uint16(b[3]) + 1
+	if index != 0 {
+		// Index pages hold CVs 257-512
+		first += 256
 	}
-	// If we don't have a match, store this one and wait for the next
-	// Technically any addressed messages received including broadcasts should invalidate
-	// lastXPOM but for now we'll just make sure the last received XPOM message is identical
-	if !match {
-		m.lastXPOM = m.lastXPOM[:0]
-		for _, v := range b {
-			m.lastXPOM = append(m.lastXPOM, v)
+	if op != 0b01 && !m.confirmed() {
+		if m.pendingDone {
+			m.xpomReply(seq, index, first)
 		}
 		return false
 	}
@@ -48,37 +47,75 @@ func (m *Message) handleXPOM(b []byte) bool {
 	// 11 = write bytes
 	// 10 = write bits
 
-	// seq := b[0] & 0b11 // TODO: What is this for?
-	// Find in https://www.nmra.org/sites/default/files/standards/sandrp/Draft/DCC/s-9.3.2_bi-directional_communication.pdf
-	index := m.cv.IndexPage(b[1], b[2])
-	switch (b[0] >> 2) & 0b11 {
+	switch op {
 	case 0b01:
-		// Read bytes
-		// All XPOM commands respond with four consecutive CV values
-		// This one just doesn't write anything
+		// Read bytes, nothing to write
 	case 0b11:
 		// Write bytes
 		if len(b) < 5 {
 			return false
 		}
+		// Check every CV before writing any of them, so a rejected write doesn't leave half the bytes written
+		for i := range b[4:] {
+			cvNum := first + uint16(i)
+			if _, ok := m.cv.IndexedCVOk(index, cvNum); !ok || m.decoderLocked(cvNum) {
+				return false
+			}
+		}
 		for i, v := range b[4:] {
-			if !m.cv.IndexedSet(index, uint16(b[3])+uint16(i), v) {
+			if !m.cv.PageSet(index, first+uint16(i), v) {
 				return false
 			}
 		}
 	case 0b10:
 		// Write bits
-		if len(b) < 5 {
+		// 1110CCSS AAAAAAAA AAAAAAAA AAAAAAAA 111KDBBB
+		// K: 0 = verify, 1 = write
+		if len(b) < 5 || b[4]&0b11100000 != 0b11100000 {
+			return false
+		}
+		v, ok := m.cv.IndexedCVOk(index, first)
+		if !ok || m.decoderLocked(first) {
 			return false
 		}
-		m.cvCommand(index, b[3:])
+		if b[4]&0b10000 != 0 {
+			pos := b[4] & 0b111
+			bit := (b[4] >> 3) & 1
+			if !m.cv.PageSet(index, first, (v&^(1<<pos))|(bit<<pos)) {
+				return false
+			}
+		}
+	default:
+		// Reserved
+		return false
 	}
 
-	// Return the four bytes via BiDi communication
-	for i := range uint16(4) {
-		// FIXME: Do BiDi communication
-		m.cv.IndexedCV(index, uint16(b[3])+i)
+	m.xpomReply(seq, index, first)
+	return true
+}
+
+// pomReply answers an operations mode CV access with the CV's value in RailCom channel 2 (app:pom)
+func (m *Message) pomReply(index, cvNum uint16) {
+	if !m.addressed || !m.decoder.railcomChannel2() {
+		return
 	}
+	v, ok := m.cv.IndexedCVOk(index, cvNum)
+	if !ok {
+		return
+	}
+	var buf [railcom.Channel2Size]byte
+	m.decoder.QueueRailCom(railcom.POM(buf[:0], v))
+}
 
-	return true
+// xpomReply answers an XPOM command with the values of four consecutive CVs from first (app:xpom)
+func (m *Message) xpomReply(seq uint8, index, first uint16) {
+	if !m.addressed || !m.decoder.railcomChannel2() {
+		return
+	}
+	var values [4]byte
+	for i := range uint16(4) {
+		values[i] = m.cv.IndexedCV(index, first+i)
+	}
+	var buf [railcom.Channel2Size]byte
+	m.decoder.QueueRailCom(railcom.XPOM(buf[:0], seq, values))
 }
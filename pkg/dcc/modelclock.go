@@ -0,0 +1,148 @@
+package dcc
+
+import (
+	"sync"
+	"time"
+)
+
+// ModelClock tracks the layout's model time and date broadcast by the command station (RCN-211). Between
+// packets the model time is interpolated using the broadcast rate factor. The zero value is ready to use
+type ModelClock struct {
+	mutex sync.Mutex
+	// now is the real time source, replaceable for testing
+	now func() time.Time
+
+	// Model time as of the last time packet, and the real time it was received
+	model   time.Time
+	updated time.Time
+	rate    uint8
+
+	timeOk    bool
+	dateOk    bool
+	weekday   time.Weekday
+	weekdayOk bool
+
+	// Command station system time in milliseconds, and the real time it was received
+	systemTime        uint16
+	systemTimeUpdated time.Time
+	systemTimeOk      bool
+}
+
+func (c *ModelClock) realTime() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// modelTime returns the interpolated model time, must be called with the mutex held
+func (c *ModelClock) modelTime(now time.Time) time.Time {
+	return c.model.Add(now.Sub(c.updated) * time.Duration(c.rate))
+}
+
+// Now returns the current model date and time. The date is January 1st of year 1 until a date packet has been
+// received and ok is false until a time packet has been received
+func (c *ModelClock) Now() (time.Time, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.timeOk {
+		return time.Time{}, false
+	}
+	return c.modelTime(c.realTime()), true
+}
+
+// HasDate reports whether a model date packet has been received
+func (c *ModelClock) HasDate() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.dateOk
+}
+
+// Weekday returns the current model day of the week, which isn't necessarily the same as the model date's
+func (c *ModelClock) Weekday() (time.Weekday, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.timeOk || !c.weekdayOk {
+		return 0, false
+	}
+	days := int(dayStart(c.modelTime(c.realTime())).Sub(dayStart(c.model)) / (24 * time.Hour))
+	return (c.weekday + time.Weekday(days%7)) % 7, true
+}
+
+// Rate returns the model time acceleration factor, 0 means the model clock is stopped
+func (c *ModelClock) Rate() uint8 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.rate
+}
+
+// SystemTime returns the command station's 16-bit millisecond system time, interpolated since the last packet
+func (c *ModelClock) SystemTime() (uint16, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.systemTimeOk {
+		return 0, false
+	}
+	return c.systemTime + uint16(c.realTime().Sub(c.systemTimeUpdated).Milliseconds()), true
+}
+
+// setTime updates the model time of day, weekday and rate factor
+func (c *ModelClock) setTime(hour, minute int, weekday uint8, rate uint8) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.realTime()
+	date := dayStart(c.model)
+	if c.timeOk {
+		// Keep the model date in step when the time of day wraps around midnight
+		current := c.modelTime(now)
+		date = dayStart(current)
+		tod := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+		switch diff := tod - current.Sub(date); {
+		case diff < -12*time.Hour:
+			date = date.AddDate(0, 0, 1)
+		case diff > 12*time.Hour:
+			date = date.AddDate(0, 0, -1)
+		}
+	}
+
+	c.model = date.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	c.updated = now
+	c.rate = rate
+	c.timeOk = true
+
+	// Weekdays are sent as 0 = Monday through 6 = Sunday, 7 means no weekday
+	c.weekdayOk = weekday < 7
+	c.weekday = time.Weekday(weekday+1) % 7
+}
+
+// setDate updates the model date, leaving the time of day untouched
+func (c *ModelClock) setDate(year, month, day int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.realTime()
+	current := c.modelTime(now)
+	tod := current.Sub(dayStart(current))
+
+	c.model = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Add(tod)
+	c.updated = now
+	c.dateOk = true
+}
+
+func (c *ModelClock) setSystemTime(ms uint16) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.systemTime = ms
+	c.systemTimeUpdated = c.realTime()
+	c.systemTimeOk = true
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Clock returns the model clock kept up to date by the command station's time broadcasts
+func (d *Decoder) Clock() *ModelClock {
+	return &d.clock
+}
@@ -0,0 +1,88 @@
+package dcc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/motor"
+)
+
+func TestModelClock(t *testing.T) {
+	d := &Decoder{address: []byte{3}, motor: &motor.Motor{}}
+	msg := &Message{decoder: d}
+
+	wall := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	d.clock.now = func() time.Time { return wall }
+	clock := d.Clock()
+
+	if _, ok := clock.Now(); ok {
+		t.Fatalf("model time valid before any time packets")
+	}
+
+	// Friday 23:58 at 4x speed
+	if !msg.featureExpansion([]byte{0xC1, 58, 4<<5 | 23, 4}) {
+		t.Fatalf("model time packet rejected")
+	}
+	now, ok := clock.Now()
+	if !ok || now.Hour() != 23 || now.Minute() != 58 {
+		t.Errorf("model time = %s (ok: %t), want 23:58", now.Format("15:04"), ok)
+	}
+	if wd, ok := clock.Weekday(); !ok || wd != time.Friday {
+		t.Errorf("weekday = %s (ok: %t), want Friday", wd, ok)
+	}
+	if clock.Rate() != 4 {
+		t.Errorf("rate = %d, want 4", clock.Rate())
+	}
+
+	// 1 wall minute is 4 model minutes, crossing midnight into Saturday
+	wall = wall.Add(time.Minute)
+	now, _ = clock.Now()
+	if now.Hour() != 0 || now.Minute() != 2 {
+		t.Errorf("interpolated model time = %s, want 00:02", now.Format("15:04"))
+	}
+	if wd, _ := clock.Weekday(); wd != time.Saturday {
+		t.Errorf("weekday after midnight = %s, want Saturday", wd)
+	}
+
+	// Date packet for 2026-03-14 keeps the time of day
+	if !msg.featureExpansion([]byte{0xC1, 0b01000000 | 14, 3<<4 | 2026>>8, 2026 & 0xFF}) {
+		t.Fatalf("model date packet rejected")
+	}
+	now, _ = clock.Now()
+	if !clock.HasDate() || now.Format("2006-01-02 15:04") != "2026-03-14 00:02" {
+		t.Errorf("model date and time = %s, want 2026-03-14 00:02", now.Format("2006-01-02 15:04"))
+	}
+
+	// A time packet slightly behind our interpolated time doesn't roll the date back
+	msg.featureExpansion([]byte{0xC1, 1, 7<<5 | 0, 0})
+	now, _ = clock.Now()
+	if now.Format("2006-01-02 15:04") != "2026-03-14 00:01" {
+		t.Errorf("model date and time = %s, want 2026-03-14 00:01", now.Format("2006-01-02 15:04"))
+	}
+	if _, ok := clock.Weekday(); ok {
+		t.Errorf("weekday valid after a packet without one")
+	}
+
+	// Rate 0 stops the clock
+	wall = wall.Add(time.Hour)
+	if later, _ := clock.Now(); !later.Equal(now) {
+		t.Errorf("stopped clock moved from %s to %s", now.Format("15:04"), later.Format("15:04"))
+	}
+
+	// Invalid times are rejected
+	if msg.featureExpansion([]byte{0xC1, 60, 0, 1}) {
+		t.Errorf("accepted minute 60")
+	}
+	if msg.featureExpansion([]byte{0xC1, 0b01000000 | 1, 13 << 4, 0}) {
+		t.Errorf("accepted month 13")
+	}
+
+	// System time
+	if !msg.featureExpansion([]byte{0xC2, 0x01, 0x00}) {
+		t.Fatalf("system time packet rejected")
+	}
+	wall = wall.Add(300 * time.Millisecond)
+	if ms, ok := clock.SystemTime(); !ok || ms != 0x0100+300 {
+		t.Errorf("system time = %d (ok: %t), want %d", ms, ok, 0x0100+300)
+	}
+}
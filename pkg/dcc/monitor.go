@@ -6,101 +6,80 @@ import (
 )
 
 func (d *Decoder) Monitor() {
-	// The earlier rev rp2350 decoder's smoothing cap adds ~6us to one half-wave
-	// TODO: Make this configurable
-	delay := uint32(6)
-
-	tr1Min := tr1MinTime + delay
-	tr1Max := tr1MaxTime + delay
-	tr0Min := tr0MinTime + delay
-	tr0Max := tr0MaxTime + delay
-
-	var bit int
-	var out byte
-
 	msg := NewMessage(d.cv, d)
 
-	i := 0
-	state := Preamble
 	for {
-		// Save the wave time readings in the ring buffer so we don't lose any
-		for !d.sm.IsRxFIFOEmpty() && !d.buf.Full() {
-			// FIXME: Buffered channel instead?
-			d.buf.Put(d.sm.RxGet())
-		}
-		for d.buf.Used() > 0 {
-			// Two cycles per loop / 2 MHz clock = 1 microsecond per tick
-			ticks, ok := d.buf.Get()
-			if !ok {
-				// No data available, sleep and wait for more data to be processed
-				break
-			}
+		d.receive(msg)
 
-			// Make sure the bit is within the valid ranges
-			bit = 0
-			if ticks >= tr1Min && ticks <= tr1Max {
-				bit = 1
-			} else if ticks < tr0Min || ticks > tr0Max {
-				// Noise
-				continue
-			}
+		now := time.Now()
+		d.tick(now)
+		if !d.packetEnding(now) {
+			time.Sleep(100 * time.Microsecond) // Sleep a bit to avoid busy-waiting
+		}
+	}
+}
 
-			// Increment the bit counter
-			i++
+// receive decodes the half-waves the PIO has measured since the last call, handling any packets they complete
+func (d *Decoder) receive(msg *Message) {
+	// Save the wave time readings in the ring buffer so we don't lose any
+	read := d.rcTx.realTime()
+	for !d.sm.IsRxFIFOEmpty() && !d.buf.Full() {
+		// FIXME: Buffered channel instead?
+		d.buf.Put(d.sm.RxGet())
+		d.lastWave = read
+	}
+	for d.buf.Used() > 0 {
+		// Two cycles per loop / 2 MHz clock = 1 microsecond per tick
+		ticks, ok := d.buf.Get()
+		if !ok {
+			// No data available, sleep and wait for more data to be processed
+			break
+		}
 
-			switch state {
-			case Preamble:
-				// Waiting for the preamble count to be satisfied
-				if bit == 0 {
-					if i >= preambleLength {
-						// Preamble terminator bit received, ready to decode data
-						state = Bits
-						i = 0
-					} else {
-						// Reset the bit counter, we got a premature terminating bit
-						i = 0
-					}
-				}
-			case Bits:
-				// Shift in a zero bit
-				out <<= 1
-				// Set it to 1
-				if bit == 1 {
-					out |= 1
-				}
-				// Next bit will be a terminator, save byte and prep for the next loop
-				if i == 8 {
-					msg.AddByte(out)
-					out = 0
-					state = Terminator
-				}
-			case Terminator:
-				i = 0
-				state = Bits
+		packet, ok := d.bits.add(ticks)
+		if !ok {
+			continue
+		}
 
-				if bit == 1 {
-					// End of message terminator bit received, wait for a preamble next loop
-					state = Preamble
+		// Unless there's a backlog the end bit was only just published, so the cutout can still be caught
+		fresh := d.buf.Used() == 0 && d.sm.IsRxFIFOEmpty()
+		d.handlePacket(msg, packet, read, fresh)
 
-					if msg.XOR() {
-						msg.Process()
+		// Make sure we reset if we stop receiving valid messages
+		d.hw.WatchdogReset()
+		runtime.Gosched()
+	}
+}
 
-						// Make sure we reset if we stop receiving valid messages
-						d.hw.WatchdogReset()
-					} else {
-						d.checksumErrorCount++
-					}
+// handlePacket processes a packet whose end bit was read at seen, sending our RailCom data if the command station
+// cuts out after it. Channel 1 is queued before processing, which can take longer than the channel 1 window, but
+// DCC-A replies take both channels and are only known once the logon packet has been processed
+func (d *Decoder) handlePacket(msg *Message, packet []byte, seen time.Time, fresh bool) {
+	var end time.Time
+	cutout := false
+	if fresh && d.railcomActive() {
+		end, cutout = d.awaitCutout(seen)
+	}
+	// Logon packets are sent to address 254
+	early := cutout && packet[0] != 254
+	if early {
+		d.cutoutChannel1(end)
+	}
 
-					// Reset the message buffer for the next message
-					msg.Reset()
-					runtime.Gosched()
-				}
-			default:
-				println("ERROR: invalid decoder state: ", state)
-				state = Preamble
-				msg.Reset()
-			}
-		}
-		time.Sleep(100 * time.Microsecond) // Sleep a bit to avoid busy-waiting
+	msg.AddBytes(packet)
+	msg.Process()
+	if early {
+		d.cutoutChannel2(end, msg.addressed)
+	} else if cutout {
+		d.cutout(end, msg.addressed)
 	}
+
+	// Reset the message buffer for the next message
+	msg.Reset()
+}
+
+// packetEnding reports whether the next half-wave may be a packet end bit. Monitor keeps polling instead of
+// sleeping then, so the end bit and the cutout after it are seen as they happen
+func (d *Decoder) packetEnding(now time.Time) bool {
+	return d.bits.state == Terminator && d.railcomActive() && now.Sub(d.lastWave) < rcSpinLimit
 }
@@ -5,26 +5,30 @@ package dcc
 import (
 	"errors"
 	"machine"
+	"time"
 
 	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
 	pio "github.com/tinygo-org/pio/rp2-pio"
 )
 
-func (d *Decoder) initPIO(pioNum int, p shared.Pin) error {
-	var sm pio.StateMachine
-	var err error
-	pin := p.(machine.Pin)
-
+func claimStateMachine(pioNum int) (pio.StateMachine, error) {
 	switch pioNum {
 	case 0:
-		sm, err = pio.PIO0.ClaimStateMachine()
+		return pio.PIO0.ClaimStateMachine()
 	case 1:
-		sm, err = pio.PIO1.ClaimStateMachine()
+		return pio.PIO1.ClaimStateMachine()
 	case 2:
 		// TODO: Enable PIO2 support when available
-		// sm, err = pio.PIO2.ClaimStateMachine()
-		return errors.New("PIO2 not yet supported")
+		// return pio.PIO2.ClaimStateMachine()
+		return pio.StateMachine{}, errors.New("PIO2 not yet supported")
 	}
+	return pio.StateMachine{}, errors.New("invalid PIO number")
+}
+
+func (d *Decoder) initPIO(pioNum int, p shared.Pin) error {
+	pin := p.(machine.Pin)
+
+	sm, err := claimStateMachine(pioNum)
 	if err != nil {
 		return err
 	}
@@ -57,8 +61,84 @@ func (d *Decoder) initPIO(pioNum int, p shared.Pin) error {
 	sm.SetClkDiv(whole, frac)
 
 	d.sm = sm
+	d.dccPin = p
 	d.offset = offset
 	d.Enable(true)
 
 	return nil
 }
+
+// initRailcom sets up the PIO UART that sends RailCom data in the cutout
+func (d *Decoder) initRailcom(pioNum int, p shared.Pin) error {
+	pin, ok := p.(machine.Pin)
+	if !ok {
+		// No RailCom transmitter on this board
+		return nil
+	}
+
+	sm, err := claimStateMachine(pioNum)
+	if err != nil {
+		return err
+	}
+	Pio := sm.PIO()
+
+	offset, err := Pio.AddProgram(railcomInstructions, railcomOrigin)
+	if err != nil {
+		return err
+	}
+
+	// 8 cycles per bit at 2MHz gives 250kbaud
+	whole, frac, err := pio.ClkDivFromFrequency(smFreq, machine.CPUFrequency())
+	if err != nil {
+		return err
+	}
+
+	pin.Configure(machine.PinConfig{Mode: Pio.PinMode()})
+	// Idle high, which is no current on the track
+	sm.SetPinsConsecutive(pin, 1, true)
+	sm.SetPindirsConsecutive(pin, 1, true)
+
+	cfg := railcomProgramDefaultConfig(offset)
+	cfg.SetOutPins(pin, 1)
+	cfg.SetSidesetPins(pin)
+	// Shift right so the delay comes out first, followed by the data bits LSB first
+	cfg.SetOutShift(true, false, 32)
+	// A cutout is at most 8 bytes, which fits in the joined TX FIFO
+	cfg.SetFIFOJoin(pio.FifoJoinTx)
+
+	sm.Init(offset, cfg)
+	sm.SetClkDiv(whole, frac)
+	sm.SetEnabled(true)
+
+	d.rcTx.uart = &pioRailcomUART{sm: sm}
+	return nil
+}
+
+type pioRailcomUART struct {
+	sm pio.StateMachine
+	// When the bytes already queued will have been sent
+	busy time.Time
+}
+
+// Send queues bytes in the PIO FIFO, the first one waiting out delay before its start bit
+func (u *pioRailcomUART) Send(delay time.Duration, b []byte) {
+	delay = max(delay, 0)
+	// Two PIO cycles per microsecond
+	cycles := uint32(delay.Microseconds() * smFreq / 1_000_000)
+
+	now := time.Now()
+	start := now
+	if u.busy.After(now) {
+		// The delay follows straight on from the last byte's stop bit
+		start = u.busy
+	} else {
+		// An idle state machine spends some cycles getting from the pull to the start bit
+		cycles -= min(cycles, rcTxOverhead)
+	}
+	u.busy = start.Add(delay + time.Duration(len(b))*rcByteTime)
+
+	for _, v := range b {
+		u.sm.TxPut(uint32(v)<<24 | cycles&0xFFFFFF)
+		cycles = 0
+	}
+}
@@ -0,0 +1,275 @@
+package dcc
+
+import (
+	"time"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/railcom"
+)
+
+// railcomUART sends bytes at 250kbaud. The delay before the first byte is counted from the end of any bytes
+// still being sent, or from now if the UART is idle
+type railcomUART interface {
+	Send(delay time.Duration, b []byte)
+}
+
+type rcDatagram struct {
+	b [railcom.Channel2Size]byte
+	n uint8
+}
+
+type railcomTx struct {
+	uart railcomUART
+	// now is the time source, replaceable for testing
+	now func() time.Time
+
+	queue [rcQueueSize]rcDatagram
+	head  int
+	count int
+
+	// Channel 1 alternates between the app:adr_high and app:adr_low datagrams
+	adrLow bool
+
+	// Next app:dyn variable to report, and the packet counters as of the last QoS report
+	dynNext    int
+	qosErrors  uint32
+	qosPackets uint32
+
+	// When the bytes handed to the UART so far finish, and whether channel 1 was used in the current cutout
+	idle    time.Time
+	ch1Used bool
+
+	ch1 [railcom.Channel1Size]byte
+	ch2 [railcom.Channel1Size + railcom.Channel2Size]byte
+}
+
+func (t *railcomTx) realTime() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+// next packs as many queued datagrams as fit into channel 2, returning the number of datagrams used
+func (t *railcomTx) next(dst []byte) ([]byte, int) {
+	used := 0
+	for ; used < t.count; used++ {
+		dg := &t.queue[(t.head+used)%rcQueueSize]
+		if len(dst)+int(dg.n) > railcom.Channel2Size {
+			break
+		}
+		dst = append(dst, dg.b[:dg.n]...)
+	}
+	return dst, used
+}
+
+func (t *railcomTx) drop(n int) {
+	t.head = (t.head + n) % rcQueueSize
+	t.count -= n
+}
+
+// sendWindow schedules b to go out within a channel window measured from the end of the packet, after anything
+// already handed to the UART. It reports whether b was sent, which it isn't if it can no longer finish in time
+func (t *railcomTx) sendWindow(end time.Time, open, close time.Duration, b []byte) bool {
+	if t.uart == nil || len(b) == 0 {
+		return false
+	}
+
+	from := t.realTime()
+	if t.idle.After(from) {
+		from = t.idle
+	}
+	start, ok := rcWindow(from, end.Add(open), end.Add(close), len(b))
+	if !ok {
+		return false
+	}
+	t.uart.Send(start.Sub(from), b)
+	t.idle = start.Add(time.Duration(len(b)) * rcByteTime)
+	return true
+}
+
+// rcWindow returns when to start sending n bytes in a channel, ok is false if they can't finish before it closes
+func rcWindow(now, open, close time.Time, n int) (time.Time, bool) {
+	start := open
+	if now.After(start) {
+		start = now
+	}
+	return start, !start.Add(time.Duration(n) * rcByteTime).After(close)
+}
+
+// railcomEnabled checks CV29 bit 3
+func (d *Decoder) railcomEnabled() bool {
+	return d.cv.CV(29)&0b00001000 != 0
+}
+
+// railcomChannel2 checks whether we may answer in channel 2, enabled with CV28 bit 1
+func (d *Decoder) railcomChannel2() bool {
+	return d.railcomEnabled() && d.cv.CV(28)&0b10 != 0
+}
+
+// QueueRailCom queues a 4/8 coded datagram, built with the railcom package, to be sent in channel 2 after the
+// next packet addressed to us. It returns false if the datagram doesn't fit in channel 2 or the queue is full
+func (d *Decoder) QueueRailCom(datagram []byte) bool {
+	t := &d.rcTx
+	if len(datagram) == 0 || len(datagram) > railcom.Channel2Size || t.count == rcQueueSize {
+		return false
+	}
+
+	dg := &t.queue[(t.head+t.count)%rcQueueSize]
+	dg.n = uint8(copy(dg.b[:], datagram))
+	t.count++
+	return true
+}
+
+// railcomActive reports whether we transmit in the cutout at all
+func (d *Decoder) railcomActive() bool {
+	return d.rcTx.uart != nil && d.railcomEnabled()
+}
+
+// cutout sends our RailCom data in the cutout following a packet, once the packet has been processed. end is
+// when the packet end bit finished and addressed is whether the packet was sent to our own address, only those
+// may be answered in channel 2
+func (d *Decoder) cutout(end time.Time, addressed bool) {
+	d.cutoutChannel1(end)
+	d.cutoutChannel2(end, addressed)
+}
+
+// cutoutChannel1 sends the channel 1 address broadcast, allowing detectors to find us. It doesn't depend on the
+// packet, so Monitor sends it before processing the packet
+func (d *Decoder) cutoutChannel1(end time.Time) {
+	t := &d.rcTx
+	t.ch1Used = false
+	if !d.railcomActive() || d.logon.replyOk || d.accessory || d.cv.CV(28)&0b01 == 0 {
+		return
+	}
+	if t.sendWindow(end, rcChannel1Start, rcChannel1End, d.railcomAddress(t.ch1[:0], t.adrLow)) {
+		t.adrLow = !t.adrLow
+		t.ch1Used = true
+	}
+}
+
+// cutoutChannel2 sends any reply to the packet, which may only be known once it's been processed
+func (d *Decoder) cutoutChannel2(end time.Time, addressed bool) {
+	t := &d.rcTx
+	if !d.railcomActive() {
+		return
+	}
+
+	if d.logon.replyOk {
+		// DCC-A replies use both channels as a single block, which can't be sent once channel 1 is taken
+		d.logon.replyOk = false
+		if t.ch1Used {
+			return
+		}
+		b := railcom.Raw48(t.ch2[:0], d.logon.reply)
+		if t.sendWindow(end, rcChannel1Start, rcChannel1End, b[:railcom.Channel1Size]) {
+			t.sendWindow(end, rcChannel2Start, rcChannel2End, b[railcom.Channel1Size:])
+		}
+		return
+	}
+
+	if !addressed || !d.railcomChannel2() {
+		return
+	}
+	ch2, used := t.next(t.ch2[:0])
+	// Spare room is filled with telemetry
+	ch2 = d.appendDyn(ch2)
+	if t.sendWindow(end, rcChannel2Start, rcChannel2End, ch2) {
+		t.drop(used)
+	}
+}
+
+// awaitCutout watches the DCC input after a packet end bit that was read from the PIO at seen, returning when the
+// packet ended if the command station cuts out for RailCom. The PIO only times the low half of each bit, so which
+// half of the cutout start shows up depends on which way round we sit on the track:
+//
+//   - Low during the second half of each bit: the end bit is published as the packet ends, and the cutout start
+//     and the cutout itself leave the input high for longer than any one bit
+//   - Low during the first half: the short cutout start half-wave is published as the cutout begins
+//
+// Any other half-wave is the next preamble, which is left for the bit decoder
+func (d *Decoder) awaitCutout(seen time.Time) (time.Time, bool) {
+	timing := d.bits.timing
+	// The edge delay shortens the high halves rather than lengthening them, so only the tolerance applies here
+	highMax := time.Duration(tr1MaxTime+d.bits.bitTolerance) * time.Microsecond
+	for {
+		now := d.rcTx.realTime()
+		if !d.sm.IsRxFIFOEmpty() {
+			ticks := d.sm.RxGet()
+			if timing.cutoutStart(ticks) {
+				return now.Add(-time.Duration(ticks) * time.Microsecond), true
+			}
+			d.buf.Put(ticks)
+			return time.Time{}, false
+		}
+
+		waited := now.Sub(seen)
+		if waited > highMax && d.dccPin != nil && d.dccPin.Get() {
+			return seen, true
+		}
+		if waited > rcCutoutWait {
+			return time.Time{}, false
+		}
+	}
+}
+
+// railcomAddress appends our app:adr_high or app:adr_low datagram
+func (d *Decoder) railcomAddress(dst []byte, low bool) []byte {
+	addr, long := d.addressValue()
+	kind := railcom.ShortAddress
+	if long {
+		kind = railcom.LongAddress
+	}
+
+	if low {
+		return railcom.AddressLow(dst, addr, kind)
+	}
+	return railcom.AddressHigh(dst, addr, kind)
+}
+
+// dynVariables are reported in turn, speed covers both the low and high speed indexes
+var dynVariables = [...]uint8{dynSpeed, dynQoS, dynTemperature}
+
+// appendDyn appends as many app:dyn datagrams as fit in channel 2, continuing where the last cutout left off
+func (d *Decoder) appendDyn(dst []byte) []byte {
+	t := &d.rcTx
+	for range len(dynVariables) {
+		if len(dst)+3 > railcom.Channel2Size {
+			break
+		}
+		dv := dynVariables[t.dynNext]
+		t.dynNext = (t.dynNext + 1) % len(dynVariables)
+		if index, value, ok := d.dynValue(dv); ok {
+			dst = railcom.Dyn(dst, index, value)
+		}
+	}
+	return dst
+}
+
+// dynValue returns the current value of an app:dyn variable, ok is false if we have nothing to report
+func (d *Decoder) dynValue(dv uint8) (uint8, uint8, bool) {
+	switch dv {
+	case dynSpeed:
+		if d.accessory || d.motor == nil {
+			return 0, 0, false
+		}
+		kmh := min(uint16(d.motor.ActualSpeed()*float32(d.cv.CV(127))+0.5), 511)
+		if kmh > 255 {
+			return dynSpeedHigh, uint8(kmh - 256), true
+		}
+		return dynSpeed, uint8(kmh), true
+	case dynQoS:
+		t := &d.rcTx
+		packets := d.bits.packets - t.qosPackets
+		errors := d.bits.errors[errChecksum] - t.qosErrors
+		if packets == 0 {
+			return 0, 0, false
+		}
+		t.qosPackets = d.bits.packets
+		t.qosErrors = d.bits.errors[errChecksum]
+		return dynQoS, uint8(min(errors*100/packets, 100)), true
+	case dynTemperature:
+		c := d.hw.Temperature() + 50
+		return dynTemperature, uint8(min(max(c, 0), 255)), true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,532 @@
+package dcc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/hal"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/railcom"
+)
+
+type rcTransmission struct {
+	start time.Time
+	b     []byte
+}
+
+// fakeUART records when each block of bytes would start going out on the pin
+type fakeUART struct {
+	now  func() time.Time
+	idle time.Time
+	sent []rcTransmission
+}
+
+func (u *fakeUART) Send(delay time.Duration, b []byte) {
+	start := u.now()
+	if u.idle.After(start) {
+		start = u.idle
+	}
+	start = start.Add(delay)
+	u.idle = start.Add(time.Duration(len(b)) * rcByteTime)
+	u.sent = append(u.sent, rcTransmission{start: start, b: append([]byte(nil), b...)})
+}
+
+func newTestRailcom(t *testing.T, cvs map[uint16]uint8) (*Decoder, *fakeUART, *time.Time) {
+	t.Helper()
+	d, _ := newTestDecoder(t, cvs)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	uart := &fakeUART{now: clock}
+	d.rcTx.uart = uart
+	d.rcTx.now = clock
+	return d, uart, &now
+}
+
+func TestRailcomCutoutTiming(t *testing.T) {
+	tests := []struct {
+		name      string
+		latency   time.Duration
+		expectCh1 bool
+		expectCh2 bool
+	}{
+		{
+			name:      "Both channels",
+			latency:   10 * time.Microsecond,
+			expectCh1: true,
+			expectCh2: true,
+		},
+		{
+			name:      "Channel 1 late start",
+			latency:   90 * time.Microsecond,
+			expectCh1: true,
+			expectCh2: true,
+		},
+		{
+			name:      "Too late for channel 1",
+			latency:   120 * time.Microsecond,
+			expectCh1: false,
+			expectCh2: true,
+		},
+		{
+			name:      "Too late for both",
+			latency:   400 * time.Microsecond,
+			expectCh1: false,
+			expectCh2: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, uart, now := newTestRailcom(t, map[uint16]uint8{1: 3, 28: 0b11, 29: 0b00001010})
+			if !d.QueueRailCom(railcom.POM(nil, 0x42)) {
+				t.Fatalf("QueueRailCom() = false, want true")
+			}
+
+			end := *now
+			*now = now.Add(tt.latency)
+			d.cutout(end, true)
+
+			var ch1, ch2 *rcTransmission
+			for i := range uart.sent {
+				s := &uart.sent[i]
+				switch {
+				case bytes.Equal(s.b, railcom.AddressHigh(nil, 3, railcom.ShortAddress)):
+					ch1 = s
+				case bytes.HasPrefix(s.b, railcom.POM(nil, 0x42)):
+					ch2 = s
+				default:
+					t.Errorf("unexpected transmission % x", s.b)
+				}
+			}
+
+			if (ch1 != nil) != tt.expectCh1 {
+				t.Fatalf("channel 1 sent = %t, want %t", ch1 != nil, tt.expectCh1)
+			}
+			if ch1 != nil {
+				offset := ch1.start.Sub(end)
+				if offset < rcChannel1Start || offset+2*rcByteTime > rcChannel1End {
+					t.Errorf("channel 1 sent at %s, outside its window", offset)
+				}
+			}
+
+			if (ch2 != nil) != tt.expectCh2 {
+				t.Fatalf("channel 2 sent = %t, want %t", ch2 != nil, tt.expectCh2)
+			}
+			if ch2 != nil {
+				offset := ch2.start.Sub(end)
+				if offset < rcChannel2Start || offset+time.Duration(len(ch2.b))*rcByteTime > rcChannel2End {
+					t.Errorf("channel 2 sent at %s, outside its window", offset)
+				}
+			}
+
+			// Unsent datagrams stay queued for the next packet
+			if queued := d.rcTx.count == 1; queued == tt.expectCh2 {
+				t.Errorf("datagram still queued = %t, want %t", queued, !tt.expectCh2)
+			}
+		})
+	}
+}
+
+func TestRailcomChannels(t *testing.T) {
+	d, uart, now := newTestRailcom(t, map[uint16]uint8{17: 0xC4, 18: 0xD2, 28: 0b11, 29: 0b00101010})
+	msg := NewMessage(d.cv, d)
+
+	cutout := func(packet []byte) [][]byte {
+		t.Helper()
+		uart.sent = uart.sent[:0]
+		msg.AddBytes(packet)
+		msg.Process()
+		d.cutout(*now, msg.addressed)
+		msg.Reset()
+		*now = now.Add(10 * time.Millisecond)
+
+		var sent [][]byte
+		for _, s := range uart.sent {
+			sent = append(sent, s.b)
+		}
+		return sent
+	}
+
+	// Channel 1 alternates between the high and low address bytes, after every packet
+	other := withChecksum(0x05, 0x60)
+	if got := cutout(other); len(got) != 1 || !bytes.Equal(got[0], railcom.AddressHigh(nil, 1234, railcom.LongAddress)) {
+		t.Errorf("first cutout = % x, want app:adr_high", got)
+	}
+	if got := cutout(other); len(got) != 1 || !bytes.Equal(got[0], railcom.AddressLow(nil, 1234, railcom.LongAddress)) {
+		t.Errorf("second cutout = % x, want app:adr_low", got)
+	}
+
+	// Channel 2 is only used after packets addressed to us, packing as many datagrams as fit and filling any
+	// remaining space with telemetry
+	d.QueueRailCom(railcom.POM(nil, 1))
+	d.QueueRailCom(railcom.Dyn(nil, 0, 2))
+	d.QueueRailCom(railcom.Dyn(nil, 1, 3))
+	if got := cutout(other); len(got) != 1 {
+		t.Errorf("cutout after another decoder's packet = % x, want channel 1 only", got)
+	}
+	ours := withChecksum(0xC4, 0xD2, 0x60)
+	want := append(railcom.POM(nil, 1), railcom.Dyn(nil, 0, 2)...)
+	if got := cutout(ours); len(got) != 2 || !bytes.Equal(got[1], want) {
+		t.Errorf("cutout after our packet = % x, want channel 2 % x", got, want)
+	}
+	if got := cutout(ours); len(got) != 2 || !bytes.HasPrefix(got[1], railcom.Dyn(nil, 1, 3)) {
+		t.Errorf("cutout after our packet = % x, want the remaining datagram", got)
+	}
+	if got := cutout(ours); len(got) != 2 || len(got[1]) != 6 {
+		t.Errorf("cutout with nothing queued = % x, want channel 2 telemetry", got)
+	}
+
+	// Broadcasts aren't answered in channel 2
+	d.QueueRailCom(railcom.POM(nil, 1))
+	if got := cutout(withChecksum(0x00, 0x60)); len(got) != 1 {
+		t.Errorf("cutout after a broadcast = % x, want channel 1 only", got)
+	}
+
+	// CV28 disables the channels individually
+	d.cv.Set(28, 0b10)
+	if got := cutout(ours); len(got) != 1 || !bytes.HasPrefix(got[0], railcom.POM(nil, 1)) {
+		t.Errorf("cutout with channel 1 disabled = % x, want channel 2 only", got)
+	}
+
+	// Nothing is sent with RailCom disabled in CV29
+	d.cv.Set(28, 0b11)
+	d.cv.Set(29, 0b00100010)
+	if got := cutout(other); len(got) != 0 {
+		t.Errorf("cutout with RailCom disabled = % x, want nothing", got)
+	}
+}
+
+func TestRailcomQueue(t *testing.T) {
+	d, _, _ := newTestRailcom(t, nil)
+	if d.QueueRailCom(make([]byte, railcom.Channel2Size+1)) {
+		t.Errorf("QueueRailCom() accepted a datagram longer than channel 2")
+	}
+	for i := range rcQueueSize {
+		if !d.QueueRailCom(railcom.POM(nil, uint8(i))) {
+			t.Fatalf("QueueRailCom() = false for datagram %d, want true", i)
+		}
+	}
+	if d.QueueRailCom(railcom.POM(nil, 0)) {
+		t.Errorf("QueueRailCom() accepted a datagram with a full queue")
+	}
+}
+
+func TestLogonReplyCutout(t *testing.T) {
+	d, uart, now := newTestRailcom(t, map[uint16]uint8{1: 3, 28: 0b11, 29: 0b00001010, 124: 0, 125: 0, 126: 0})
+	msg := NewMessage(d.cv, d)
+
+	msg.AddBytes(testLogonPacket(false, 0b11111111, 0x12, 0x34, 1))
+	msg.Process()
+	d.cutout(*now, msg.addressed)
+
+	// The 48-bit unique ID reply spans both channels in place of the address broadcast
+	coded := railcom.Raw48(nil, [6]byte{0xF0, 0x0D, 0x12, 0x34, 0x56, 0x78})
+	if len(uart.sent) != 2 || !bytes.Equal(uart.sent[0].b, coded[:2]) || !bytes.Equal(uart.sent[1].b, coded[2:]) {
+		t.Errorf("LOGON_ENABLE reply = %v, want % x", uart.sent, coded)
+	}
+	if d.logon.replyOk {
+		t.Errorf("logon reply still pending after the cutout")
+	}
+}
+
+func TestPOMReadback(t *testing.T) {
+	cvs := map[uint16]uint8{1: 3, 3: 5, 7: 10, 8: 13, 9: 40, 10: 128, 28: 0b10, 29: 0b00001010}
+	d, uart, now := newTestRailcom(t, cvs)
+	msg := NewMessage(d.cv, d)
+
+	cutout := func(packet []byte) []byte {
+		t.Helper()
+		uart.sent = uart.sent[:0]
+		msg.AddBytes(packet)
+		msg.Process()
+		d.cutout(*now, msg.addressed)
+		msg.Reset()
+		*now = now.Add(10 * time.Millisecond)
+
+		if len(uart.sent) != 1 {
+			t.Fatalf("sent %d transmissions, want 1", len(uart.sent))
+		}
+		return uart.sent[0].b
+	}
+
+	// Verify byte reads CV8 regardless of the value sent
+	if got, want := cutout(withChecksum(0x03, 0xE4, 7, 0)), railcom.POM(nil, 13); !bytes.HasPrefix(got, want) {
+		t.Errorf("CV8 read = % x, want % x", got, want)
+	}
+
+	// Writes are answered with the new value once they're confirmed, and the first copy not at all
+	write := withChecksum(0x03, 0xEC, 2, 20)
+	if got := cutout(write); bytes.HasPrefix(got, railcom.POM(nil, 5)) || bytes.HasPrefix(got, railcom.POM(nil, 20)) {
+		t.Errorf("first CV3 write = % x, want no app:pom reply", got)
+	}
+	if got, want := cutout(write), railcom.POM(nil, 20); !bytes.HasPrefix(got, want) {
+		t.Errorf("confirmed CV3 write = % x, want % x", got, want)
+	}
+	if got, want := cutout(write), railcom.POM(nil, 20); !bytes.HasPrefix(got, want) {
+		t.Errorf("repeated CV3 write = % x, want % x", got, want)
+	}
+
+	// XPOM reads return four CVs from CV7 with the sequence number straight away
+	want := railcom.XPOM(nil, 2, [4]byte{10, 13, 40, 128})
+	if got := cutout(withChecksum(0x03, 0xE6, 0, 0, 6)); !bytes.Equal(got, want) {
+		t.Errorf("XPOM read = % x, want % x", got, want)
+	}
+
+	// Other decoders' CV reads aren't answered
+	uart.sent = uart.sent[:0]
+	msg.AddBytes(withChecksum(0x04, 0xE4, 7, 0))
+	msg.Process()
+	d.cutout(*now, msg.addressed)
+	msg.Reset()
+	if len(uart.sent) != 0 || d.rcTx.count != 0 {
+		t.Errorf("answered another decoder's CV read: %v", uart.sent)
+	}
+}
+
+func TestDynamicVariables(t *testing.T) {
+	d, _, _ := newTestRailcom(t, map[uint16]uint8{1: 3, 28: 0b10, 29: 0b00001010, 127: 100})
+	t.Cleanup(func() {
+		hal.TemperatureHook = nil
+	})
+	hal.TemperatureHook = func() float32 { return 42 }
+
+	d.bits.packets = 200
+	d.bits.errors[errChecksum] = 10
+
+	tests := []struct {
+		dv     uint8
+		index  uint8
+		value  uint8
+		expect bool
+	}{
+		{dv: dynSpeed, index: dynSpeed, value: 0, expect: true},
+		{dv: dynQoS, index: dynQoS, value: 5, expect: true},
+		// QoS is only reported when packets have been received since the last report
+		{dv: dynQoS, expect: false},
+		{dv: dynTemperature, index: dynTemperature, value: 92, expect: true},
+	}
+	for _, tt := range tests {
+		index, value, ok := d.dynValue(tt.dv)
+		if ok != tt.expect || ok && (index != tt.index || value != tt.value) {
+			t.Errorf("dynValue(%d) = %d, %d, %t, want %d, %d, %t", tt.dv, index, value, ok, tt.index, tt.value, tt.expect)
+		}
+	}
+
+	// Variables take turns filling channel 2
+	d.bits.packets += 100
+	first := d.appendDyn(nil)
+	want := append(railcom.Dyn(nil, dynSpeed, 0), railcom.Dyn(nil, dynQoS, 0)...)
+	if !bytes.Equal(first, want) {
+		t.Errorf("first app:dyn cutout = % x, want speed and QoS % x", first, want)
+	}
+	second := d.appendDyn(nil)
+	want = append(railcom.Dyn(nil, dynTemperature, 92), railcom.Dyn(nil, dynSpeed, 0)...)
+	if !bytes.Equal(second, want) {
+		t.Errorf("second app:dyn cutout = % x, want temperature and speed % x", second, want)
+	}
+}
+
+type trackHalf struct {
+	low bool
+	d   time.Duration
+}
+
+// fakeTrack plays a DCC waveform into the decoder as both the PIO and the input pin would see it. Its clock moves
+// on every time it's read, so how late the decoder reacts comes from the code rather than from the test
+type fakeTrack struct {
+	now    time.Time
+	halves []trackHalf
+	starts []time.Time
+	// PIO readings not yet taken, the low half-waves published at their rising edges
+	read int
+	lows []int
+}
+
+func newFakeTrack(start time.Time, halves []trackHalf) *fakeTrack {
+	t := &fakeTrack{now: start, halves: halves}
+	at := start
+	for i, h := range halves {
+		t.starts = append(t.starts, at)
+		at = at.Add(h.d)
+		if h.low && i+1 < len(halves) && !halves[i+1].low {
+			t.lows = append(t.lows, i)
+		}
+	}
+	return t
+}
+
+func (t *fakeTrack) clock() time.Time {
+	t.now = t.now.Add(time.Microsecond)
+	return t.now
+}
+
+func (t *fakeTrack) done() bool {
+	last := len(t.halves) - 1
+	return t.now.After(t.starts[last].Add(t.halves[last].d))
+}
+
+func (t *fakeTrack) published(i int) time.Time {
+	return t.starts[i].Add(t.halves[i].d)
+}
+
+func (t *fakeTrack) IsRxFIFOEmpty() bool {
+	return t.read == len(t.lows) || t.published(t.lows[t.read]).After(t.now)
+}
+
+func (t *fakeTrack) IsRxFIFOFull() bool { return false }
+
+func (t *fakeTrack) RxFIFOLevel() uint32 {
+	n := uint32(0)
+	for _, i := range t.lows[t.read:] {
+		if !t.published(i).After(t.now) {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *fakeTrack) RxGet() uint32 {
+	i := t.lows[t.read]
+	t.read++
+	return uint32(t.halves[i].d.Microseconds())
+}
+
+func (t *fakeTrack) SetEnabled(bool) {}
+
+// Get reads the input pin, which is only pulled low by the negative half of the track signal
+func (t *fakeTrack) Get() bool {
+	for i := len(t.halves) - 1; i >= 0; i-- {
+		if !t.starts[i].After(t.now) {
+			return !t.halves[i].low
+		}
+	}
+	return true
+}
+
+func (t *fakeTrack) Configure(shared.MockPinConfig) {}
+func (t *fakeTrack) High()                          {}
+func (t *fakeTrack) Low()                           {}
+func (t *fakeTrack) Set(bool)                       {}
+
+func (t *fakeTrack) SetInterrupt(shared.MockPinChange, func(shared.Pin)) error {
+	return nil
+}
+
+// trackWaves encodes a packet the way the track carries it, with lowFirst choosing which half of each bit pulls
+// our input low. It returns the halves and the offset of the end of the packet end bit
+func trackWaves(lowFirst, cutout bool, packet ...byte) ([]trackHalf, time.Duration) {
+	const one, zero = 58 * time.Microsecond, 100 * time.Microsecond
+	var halves []trackHalf
+	var end time.Duration
+	bit := func(d time.Duration) {
+		halves = append(halves, trackHalf{low: lowFirst, d: d}, trackHalf{low: !lowFirst, d: d})
+		end += 2 * d
+	}
+
+	for range 16 {
+		bit(one)
+	}
+	for _, b := range packet {
+		bit(zero)
+		for i := 7; i >= 0; i-- {
+			if b&(1<<i) != 0 {
+				bit(one)
+			} else {
+				bit(zero)
+			}
+		}
+	}
+	bit(one)
+	packetEnd := end
+
+	if cutout {
+		// The cutout start half-wave continues the signal, then both rails are held at the same potential
+		halves = append(halves, trackHalf{low: lowFirst, d: 29 * time.Microsecond})
+		halves = append(halves, trackHalf{low: false, d: 450 * time.Microsecond})
+		if !lowFirst {
+			// The second half of the interrupted bit
+			halves = append(halves, trackHalf{low: true, d: one})
+		}
+	}
+	for range 16 {
+		bit(one)
+	}
+	return halves, packetEnd
+}
+
+func TestRailcomCutoutDetection(t *testing.T) {
+	tests := []struct {
+		name      string
+		lowFirst  bool
+		cutout    bool
+		slow      bool
+		expectCh1 bool
+		expectCh2 bool
+	}{
+		{name: "Cutout start on our side", lowFirst: true, cutout: true, expectCh1: true, expectCh2: true},
+		{name: "Cutout start on the other side", lowFirst: false, cutout: true, expectCh1: true, expectCh2: true},
+		{name: "No cutout", lowFirst: true},
+		{name: "No cutout other way round", lowFirst: false},
+		{name: "Slow processing", lowFirst: true, cutout: true, slow: true, expectCh1: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 28: 0b11, 29: 0b00001010, 33: 0b01})
+			msg := NewMessage(d.cv, d)
+
+			start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			halves, end := trackWaves(tt.lowFirst, tt.cutout, withChecksum(0x03, 0x90)...)
+			track := newFakeTrack(start, halves)
+			uart := &fakeUART{now: track.clock}
+			d.sm, d.dccPin = track, track
+			d.rcTx.uart, d.rcTx.now = uart, track.clock
+			packetEnd := start.Add(end)
+
+			if tt.slow {
+				// Processing the packet takes the rest of the cutout
+				d.RegisterOutput("lampFront", func(uint16, bool) { track.now = track.now.Add(400 * time.Microsecond) })
+			}
+			d.QueueRailCom(railcom.POM(nil, 0x42))
+
+			// Poll the way Monitor does
+			for !track.done() {
+				d.receive(msg)
+				if !d.packetEnding(track.clock()) {
+					track.now = track.now.Add(100 * time.Microsecond)
+				}
+			}
+
+			var ch1, ch2 *rcTransmission
+			for i := range uart.sent {
+				s := &uart.sent[i]
+				if bytes.HasPrefix(s.b, railcom.POM(nil, 0x42)) {
+					ch2 = s
+				} else {
+					ch1 = s
+				}
+			}
+
+			if (ch1 != nil) != tt.expectCh1 {
+				t.Fatalf("channel 1 sent = %t, want %t", ch1 != nil, tt.expectCh1)
+			}
+			if ch1 != nil {
+				offset := ch1.start.Sub(packetEnd)
+				if offset < rcChannel1Start || offset+time.Duration(len(ch1.b))*rcByteTime > rcChannel1End {
+					t.Errorf("channel 1 sent %s after the end bit, outside its window", offset)
+				}
+			}
+			if (ch2 != nil) != tt.expectCh2 {
+				t.Fatalf("channel 2 sent = %t, want %t", ch2 != nil, tt.expectCh2)
+			}
+			if ch2 != nil {
+				offset := ch2.start.Sub(packetEnd)
+				if offset < rcChannel2Start || offset+time.Duration(len(ch2.b))*rcByteTime > rcChannel2End {
+					t.Errorf("channel 2 sent %s after the end bit, outside its window", offset)
+				}
+			}
+		})
+	}
+}
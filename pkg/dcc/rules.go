@@ -0,0 +1,93 @@
+package dcc
+
+import (
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/cv"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/motor"
+)
+
+type EffectCallback func(output uint16, effect uint8)
+
+/*
+Conditional function rules, applied on top of the function mapping. Each rule is a block of ten CVs in index
+page 3 starting at CV257, so rule n starts at CV257 + n*10:
+
+	+0    Action: bits 0-1 switch the outputs on (1) or off (2), 0 leaves the rule unused. Bits 4-7 select a
+	      lighting effect (1-15) for the outputs while an "on" rule applies
+	+1/2  Outputs: outputs 0-7 in the first CV, outputs 8-12 in bits 0-4 of the second
+	+3-8  Three conditions of two CVs each, all of them must hold for the rule to apply:
+	      NTTTVVVV VVVVVVVV
+	      N: Invert the condition
+	      T: 0 = unused, 1 = function V is on, 2 = binary state V is on, 3 = running forward, 4 = moving
+	+9    Reserved
+
+Rules are applied in order, so a later rule overrides an earlier one for the same output. For example, to keep
+the rear light off while F7 is on: action 2, outputs 0b10, condition 1 = function 7
+*/
+
+// applyRules applies the conditional rules to the outputs from the function mapping, returning the outputs and
+// the effect selected for each of them
+func (d *Decoder) applyRules(outputs uint16) (uint16, [16]uint8) {
+	var effects [16]uint8
+	if d.cv == nil {
+		return outputs, effects
+	}
+
+	for rule := range uint16(maxRules) {
+		base := ruleBase + rule*ruleSize
+		action := d.cv.IndexedCV(cv.FunctionRulesPage, base)
+		if action&ruleActionMask == 0 || !d.ruleApplies(base) {
+			continue
+		}
+		ruleOutputs := uint16(d.cv.IndexedCV(cv.FunctionRulesPage, base+2)&0x1F)<<8 |
+			uint16(d.cv.IndexedCV(cv.FunctionRulesPage, base+1))
+
+		switch action & ruleActionMask {
+		case ruleActionOn:
+			outputs |= ruleOutputs
+			for i := range effects {
+				if ruleOutputs&(1<<i) != 0 {
+					effects[i] = action >> ruleEffectShift
+				}
+			}
+		case ruleActionOff:
+			outputs &^= ruleOutputs
+		}
+	}
+	return outputs, effects
+}
+
+// ruleApplies checks whether all the conditions of the rule starting at base hold
+func (d *Decoder) ruleApplies(base uint16) bool {
+	for i := range uint16(ruleConditions) {
+		hi := d.cv.IndexedCV(cv.FunctionRulesPage, base+3+i*2)
+		value := uint16(hi&0x0F)<<8 | uint16(d.cv.IndexedCV(cv.FunctionRulesPage, base+4+i*2))
+
+		var holds bool
+		switch (hi >> 4) & 0b111 {
+		case conditionUnused:
+			continue
+		case conditionFunction:
+			holds = d.Function(value)
+		case conditionBinaryState:
+			holds = d.BinaryState(value)
+		case conditionForward:
+			holds = d.lastDirection == motor.Forward
+		case conditionMoving:
+			holds = d.lastMoving
+		default:
+			// Reserved condition types never hold
+			return false
+		}
+		if holds == (hi&conditionInvert != 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// rulesTick re-applies the rules when the direction or the moving/stopped state they depend on has changed
+func (d *Decoder) rulesTick() {
+	if d.motor.Direction() != d.lastDirection || d.motor.Moving() != d.lastMoving {
+		d.updateOutputs()
+	}
+}
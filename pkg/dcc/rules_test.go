@@ -0,0 +1,83 @@
+package dcc
+
+import (
+	"testing"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/cv"
+)
+
+func TestFunctionRules(t *testing.T) {
+	d, set := newIndexedTestDecoder(t)
+
+	outputs := make(map[uint16]bool)
+	effects := make(map[uint16]uint8)
+	for _, output := range []string{"lampFront", "lampRear", "aux1", "aux2"} {
+		d.RegisterOutput(output, func(index uint16, on bool) {
+			outputs[index] = on
+		})
+		d.RegisterEffect(output, func(index uint16, effect uint8) {
+			effects[index] = effect
+		})
+	}
+
+	rule := func(n uint16, action uint8, outputs uint16, conditions ...uint16) {
+		t.Helper()
+		base := ruleBase + n*ruleSize
+		set(cv.FunctionRulesPage, base, action)
+		set(cv.FunctionRulesPage, base+1, uint8(outputs))
+		set(cv.FunctionRulesPage, base+2, uint8(outputs>>8))
+		for i, c := range conditions {
+			set(cv.FunctionRulesPage, base+3+uint16(i)*2, uint8(c>>8))
+			set(cv.FunctionRulesPage, base+4+uint16(i)*2, uint8(c))
+		}
+	}
+	// Rear light on with effect 5 while F21 is on, but kept off while F27 is on. F13 and up have no default mapping
+	rule(0, 5<<ruleEffectShift|ruleActionOn, 0b10, conditionFunction<<12|21)
+	rule(1, ruleActionOff, 0b10, conditionFunction<<12|27)
+	// aux1 on with F22 while running in reverse
+	rule(2, ruleActionOn, 0b100, conditionFunction<<12|22, (conditionInvert|conditionForward<<4)<<8)
+	// aux2 on with binary state 100
+	rule(3, ruleActionOn, 0b1000, conditionBinaryState<<12|100)
+	set(0, 29, 0b10)
+
+	check := func(name string, expect map[uint16]bool) {
+		t.Helper()
+		for index := range uint16(4) {
+			if outputs[index] != expect[index] {
+				t.Errorf("%s: output %d = %v, want %v", name, index, outputs[index], expect[index])
+			}
+		}
+	}
+
+	d.callFunction(21, true)
+	check("F21", map[uint16]bool{1: true})
+	if effects[1] != 5 {
+		t.Errorf("lampRear effect = %d, want 5", effects[1])
+	}
+
+	d.callFunction(27, true)
+	check("F21 and F27", map[uint16]bool{})
+	d.callFunction(27, false)
+	check("F27 off", map[uint16]bool{1: true})
+
+	d.callFunction(21, false)
+	check("F21 off", map[uint16]bool{})
+	if effects[1] != 0 {
+		t.Errorf("lampRear effect = %d after F21 off, want 0", effects[1])
+	}
+
+	d.callFunction(22, true)
+	check("F22 forward", map[uint16]bool{})
+	// CV29 bit 0 reverses our normal direction, the rules follow on the next tick
+	set(0, 29, 0b11)
+	d.rulesTick()
+	check("F22 reverse", map[uint16]bool{2: true})
+	set(0, 29, 0b10)
+	d.rulesTick()
+	check("F22 forward again", map[uint16]bool{})
+
+	d.setBinaryState(100, true)
+	check("Binary state", map[uint16]bool{3: true})
+	d.setBinaryState(0, false)
+	check("Binary states cleared", map[uint16]bool{})
+}
@@ -0,0 +1,40 @@
+package dcc
+
+import "time"
+
+// packetReceived restarts the packet timeout, resuming normal operation if it had expired
+func (d *Decoder) packetReceived(now time.Time) {
+	d.lastPacket = now
+	if d.timedOut {
+		println("packets resumed")
+		d.timedOut = false
+	}
+}
+
+// timeoutTick applies the CV114 timeout behaviour once no packet has been addressed to us for the CV11 timeout.
+// The timeout only starts after the first packet addressed to us, so we don't stop a loco on power up
+func (d *Decoder) timeoutTick(now time.Time) {
+	if d.timedOut || d.lastPacket.IsZero() {
+		return
+	}
+	cv11 := d.cv.CV(11)
+	if cv11 == 0 || now.Sub(d.lastPacket) < time.Duration(cv11)*100*time.Millisecond {
+		return
+	}
+
+	println("packet timeout")
+	d.timedOut = true
+	cv114 := d.cv.CV(114)
+	if !d.accessory {
+		switch cv114 & timeoutActionMask {
+		case timeoutMomentum:
+			d.motor.Stop(true)
+		case timeoutStop:
+			d.motor.Stop(false)
+		}
+	}
+	if cv114&timeoutOutputsOff != 0 {
+		d.accessoryOff = [2 * accessoryPairs]time.Time{}
+		d.outputsOff()
+	}
+}
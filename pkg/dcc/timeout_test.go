@@ -0,0 +1,84 @@
+package dcc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacketTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		cv114      uint8
+		wantSpeed  uint8
+		wantOutput bool
+	}{
+		{name: "Coast", cv114: timeoutCoast, wantSpeed: 50, wantOutput: true},
+		{name: "Momentum stop", cv114: timeoutMomentum, wantSpeed: 0, wantOutput: true},
+		{name: "Immediate stop", cv114: timeoutStop, wantSpeed: 0, wantOutput: true},
+		{name: "Stop and outputs off", cv114: timeoutStop | timeoutOutputsOff, wantSpeed: 0, wantOutput: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 11: 5, 29: 0b00000010, 33: 0b01, 114: tt.cv114})
+			msg := NewMessage(d.cv, d)
+
+			lamp := false
+			d.RegisterOutput("lampFront", func(_ uint16, on bool) { lamp = on })
+
+			// Nothing happens before the first packet addressed to us
+			d.tick(time.Now().Add(time.Hour))
+			if d.timedOut {
+				t.Fatalf("timed out before any packet was received")
+			}
+
+			processPackets(msg, withChecksum(0x03, 0x3F, 0x80|50), withChecksum(0x03, 0x90))
+			start := d.lastPacket
+			if !lamp || d.motor.TargetSpeed() != 50 {
+				t.Fatalf("lamp = %v, speed = %d before timeout", lamp, d.motor.TargetSpeed())
+			}
+
+			// Packets for other addresses don't keep us going
+			processPackets(msg, withChecksum(0x04, 0x3F, 0x80|10))
+			if d.lastPacket != start {
+				t.Errorf("packet for another address restarted the timeout")
+			}
+
+			d.tick(start.Add(400 * time.Millisecond))
+			if d.timedOut {
+				t.Fatalf("timed out after 400ms, CV11 is 500ms")
+			}
+
+			d.tick(start.Add(500 * time.Millisecond))
+			if !d.timedOut {
+				t.Fatalf("not timed out after 500ms")
+			}
+			if got := d.motor.TargetSpeed(); got != tt.wantSpeed {
+				t.Errorf("target speed = %d, want %d", got, tt.wantSpeed)
+			}
+			if lamp != tt.wantOutput {
+				t.Errorf("lamp = %v, want %v", lamp, tt.wantOutput)
+			}
+
+			// Packets returning resume normal operation
+			processPackets(msg, withChecksum(0x03, 0x3F, 0x80|30), withChecksum(0x03, 0x90))
+			if d.timedOut {
+				t.Errorf("still timed out after packets resumed")
+			}
+			if d.motor.TargetSpeed() != 30 || !lamp {
+				t.Errorf("lamp = %v, speed = %d after packets resumed", lamp, d.motor.TargetSpeed())
+			}
+		})
+	}
+}
+
+func TestPacketTimeoutDisabled(t *testing.T) {
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 11: 0, 29: 0b00000010, 114: timeoutStop})
+	msg := NewMessage(d.cv, d)
+
+	processPackets(msg, withChecksum(0x03, 0x3F, 0x80|50))
+	d.tick(d.lastPacket.Add(time.Hour))
+	if d.timedOut || d.motor.TargetSpeed() != 50 {
+		t.Errorf("timed out with CV11 = 0")
+	}
+}
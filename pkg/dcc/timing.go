@@ -0,0 +1,115 @@
+package dcc
+
+// bitTiming holds the accepted half-wave durations in microseconds, including the delay the board's input
+// circuit adds to each measured half-wave
+type bitTiming struct {
+	tr1Min, tr1Max uint32
+	tr0Min, tr0Max uint32
+	// Half-wave the command station sends after the packet end bit before cutting out for RailCom
+	tcsMin, tcsMax uint32
+}
+
+// newBitTiming widens the S-9.1 half-wave limits by tolerance on each side and shifts them by the edge delay
+func newBitTiming(delay, tolerance uint32) bitTiming {
+	// Keep a gap between the one and zero windows
+	tolerance = min(tolerance, maxBitTolerance)
+	return bitTiming{
+		tr1Min: tr1MinTime - tolerance + delay,
+		tr1Max: tr1MaxTime + tolerance + delay,
+		tr0Min: tr0MinTime - tolerance + delay,
+		tr0Max: tr0MaxTime + delay,
+		// Stay clear of the one bit window so the first preamble bit isn't taken for a cutout
+		tcsMin: rcCutoutStartMin - tolerance + delay,
+		tcsMax: min(rcCutoutStartMax+tolerance, tr1MinTime-tolerance-1) + delay,
+	}
+}
+
+// bit classifies a half-wave, ok is false for noise
+func (t bitTiming) bit(ticks uint32) (int, bool) {
+	switch {
+	case ticks >= t.tr1Min && ticks <= t.tr1Max:
+		return 1, true
+	case ticks >= t.tr0Min && ticks <= t.tr0Max:
+		return 0, true
+	}
+	return 0, false
+}
+
+// cutoutStart checks whether the half-wave following a packet end bit starts a RailCom cutout
+func (t bitTiming) cutoutStart(ticks uint32) bool {
+	return ticks >= t.tcsMin && ticks <= t.tcsMax
+}
+
+// edgeCalibration learns the edge delay from the average length of the preamble's one bits
+type edgeCalibration struct {
+	sum uint32
+	n   uint32
+}
+
+// calibrationTiming accepts one bits with any edge delay up to maxEdgeDelay while calibrating
+var calibrationTiming = bitTiming{
+	tr1Min: tr1MinTime,
+	tr1Max: tr1MaxTime + maxEdgeDelay,
+	tr0Min: tr0MinTime + maxEdgeDelay,
+	tr0Max: tr0MaxTime,
+}
+
+// add records a preamble half-wave, returning the learned edge delay once enough have been seen
+func (c *edgeCalibration) add(ticks uint32) (uint32, bool) {
+	if bit, ok := calibrationTiming.bit(ticks); !ok || bit != 1 {
+		return 0, false
+	}
+	c.sum += ticks
+	c.n++
+	if c.n < edgeCalibrationBits {
+		return 0, false
+	}
+
+	// Round to the nearest microsecond
+	avg := (c.sum + c.n/2) / c.n
+	c.sum, c.n = 0, 0
+	if avg <= tr1NominalTime {
+		return 0, true
+	}
+	return min(avg-tr1NominalTime, maxEdgeDelay), true
+}
+
+// updateBitTiming applies the CV115 edge delay and CV112 tolerance, falling back to the board's profile
+func (d *Decoder) updateBitTiming(cv112, cv115 uint8) bool {
+	delay, tolerance := d.hw.DCCTiming()
+	switch {
+	case cv112 == edgeFromBoard:
+	case cv112 <= maxBitTolerance:
+		tolerance = uint32(cv112)
+	default:
+		return false
+	}
+
+	b := &d.bits
+	b.calibrating = false
+	switch {
+	case cv115 == edgeFromBoard:
+	case cv115 == edgeCalibrate:
+		// Decode with the board's delay until we've learned our own
+		b.calibrating = true
+		b.calibration = edgeCalibration{}
+	case cv115 <= maxEdgeDelay:
+		delay = uint32(cv115)
+	default:
+		return false
+	}
+	b.timing = newBitTiming(delay, tolerance)
+	b.bitTolerance = tolerance
+	return true
+}
+
+// calibrate feeds a preamble half-wave to the edge calibration, switching to the learned delay once it's done
+func (b *bitDecoder) calibrate(ticks uint32) {
+	delay, ok := b.calibration.add(ticks)
+	if !ok {
+		return
+	}
+	println("learned DCC edge delay", delay, "us")
+	b.calibrating = false
+	b.timing = newBitTiming(delay, b.bitTolerance)
+}
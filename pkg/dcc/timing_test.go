@@ -0,0 +1,82 @@
+package dcc
+
+import "testing"
+
+func TestBitTiming(t *testing.T) {
+	tests := []struct {
+		name      string
+		delay     uint32
+		tolerance uint32
+		ticks     uint32
+		expectBit int
+		expectOk  bool
+	}{
+		{name: "One", ticks: 58, expectBit: 1, expectOk: true},
+		{name: "Zero", ticks: 100, expectBit: 0, expectOk: true},
+		{name: "Between windows", ticks: 75, expectOk: false},
+		{name: "Short noise", ticks: 20, expectOk: false},
+		{name: "Delayed one", delay: 6, ticks: 68, expectBit: 1, expectOk: true},
+		{name: "Delayed one without delay", ticks: 68, expectOk: false},
+		{name: "Short one with tolerance", tolerance: 4, ticks: 49, expectBit: 1, expectOk: true},
+		{name: "Tolerance keeps a gap", tolerance: 50, ticks: 77, expectOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bit, ok := newBitTiming(tt.delay, tt.tolerance).bit(tt.ticks)
+			if ok != tt.expectOk || ok && bit != tt.expectBit {
+				t.Errorf("bit(%d) = %d, %v, want %d, %v", tt.ticks, bit, ok, tt.expectBit, tt.expectOk)
+			}
+		})
+	}
+}
+
+func TestEdgeCalibration(t *testing.T) {
+	var c edgeCalibration
+	for i := range edgeCalibrationBits - 1 {
+		// Zero bits and noise are ignored
+		c.add(120)
+		c.add(10)
+		if _, ok := c.add(uint32(63 + i%2)); ok {
+			t.Fatalf("calibration finished after %d bits", i+1)
+		}
+	}
+	delay, ok := c.add(64)
+	if !ok || delay != 6 {
+		t.Errorf("learned delay = %d, %v, want 6, true", delay, ok)
+	}
+}
+
+func TestUpdateBitTiming(t *testing.T) {
+	d, _ := newTestDecoder(t, map[uint16]uint8{1: 3, 112: edgeFromBoard, 115: edgeFromBoard})
+
+	if !d.updateBitTiming(2, 10) {
+		t.Fatalf("CV112 = 2, CV115 = 10 rejected")
+	}
+	if d.bits.timing.tr1Min != tr1MinTime-2+10 || d.bits.timing.tr0Min != tr0MinTime-2+10 {
+		t.Errorf("timing = %+v for a 10us delay and 2us tolerance", d.bits.timing)
+	}
+	if d.updateBitTiming(edgeFromBoard, maxEdgeDelay+1) {
+		t.Errorf("CV115 above the maximum delay accepted")
+	}
+	if d.updateBitTiming(maxBitTolerance+1, edgeFromBoard) {
+		t.Errorf("CV112 above the maximum tolerance accepted")
+	}
+
+	// Calibration learns the delay from the preamble
+	if !d.updateBitTiming(0, edgeCalibrate) || !d.bits.calibrating {
+		t.Fatalf("calibration not started")
+	}
+	for range edgeCalibrationBits {
+		d.bits.calibrate(66)
+	}
+	if d.bits.calibrating {
+		t.Fatalf("still calibrating after %d bits", edgeCalibrationBits)
+	}
+	if bit, ok := d.bits.timing.bit(66 + 6); !ok || bit != 1 {
+		t.Errorf("one bit with learned 8us delay not accepted, timing = %+v", d.bits.timing)
+	}
+	if d.bits.timing.tr1Min != tr1MinTime+8 {
+		t.Errorf("tr1Min = %d, want %d", d.bits.timing.tr1Min, tr1MinTime+8)
+	}
+}
@@ -14,3 +14,8 @@ func (h *HAL) Pin(name string) shared.Pin {
 	}
 	return pin
 }
+
+// DCCTiming returns the board's DCC input edge delay and extra half-wave tolerance in microseconds
+func (h *HAL) DCCTiming() (uint32, uint32) {
+	return dccEdgeDelay, dccBitTolerance
+}
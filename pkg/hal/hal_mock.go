@@ -3,19 +3,30 @@
 package hal
 
 import (
+	"sync"
 	"time"
 
 	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
 )
 
+// DCC input timing profile in microseconds, tests measure ideal half-waves
+const (
+	dccEdgeDelay    = 0
+	dccBitTolerance = 0
+)
+
 type HAL struct {
 	pins map[string]shared.Pin
+
+	lights      map[string]*light
+	lightsMutex sync.Mutex
 }
 
 // Stub for non-RP platforms
 func NewHAL() *HAL {
 	return &HAL{
-		pins: make(map[string]shared.Pin),
+		pins:   make(map[string]shared.Pin),
+		lights: make(map[string]*light),
 	}
 }
 
@@ -37,6 +48,26 @@ func (h *HAL) InitPWM(pin shared.Pin, freq uint64, duty float32) (*SimplePWM, er
 	return &SimplePWM{}, nil
 }
 
+// Hook for the decoder unique ID in tests
+var UniqueIDHook func() uint32
+
+func (h *HAL) UniqueID() uint32 {
+	if UniqueIDHook != nil {
+		return UniqueIDHook()
+	}
+	return 0x12345678
+}
+
+// Hook for the temperature sensor in tests
+var TemperatureHook func() float32
+
+func (h *HAL) Temperature() float32 {
+	if TemperatureHook != nil {
+		return TemperatureHook()
+	}
+	return 25
+}
+
 func (h *HAL) WatchdogSet(timeout time.Duration) {}
 
 func (h *HAL) WatchdogReset() {}
@@ -4,6 +4,12 @@ package hal
 
 import "machine"
 
+// DCC input timing profile in microseconds, the delay one edge of each half-wave picks up in the input circuit
+const (
+	dccEdgeDelay    = 6
+	dccBitTolerance = 0
+)
+
 func (h *HAL) Init() {
 	clear(h.pins)
 
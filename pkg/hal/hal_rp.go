@@ -4,6 +4,7 @@ package hal
 
 import (
 	"machine"
+	"sync"
 	"time"
 )
 
@@ -20,15 +21,20 @@ const (
 
 type HAL struct {
 	pins map[string]machine.Pin
-	pwms map[machine.Pin]uint8
+	// PWM slices in use, see InitPWM
+	pwms map[uint8]pwmSlice
+
+	lights      map[string]*light
+	lightsMutex sync.Mutex
 
 	capChargeReady bool
 }
 
 func NewHAL() *HAL {
 	h := &HAL{
-		pins: make(map[string]machine.Pin),
-		pwms: make(map[machine.Pin]uint8),
+		pins:   make(map[string]machine.Pin),
+		pwms:   make(map[uint8]pwmSlice),
+		lights: make(map[string]*light),
 	}
 
 	h.Init()
@@ -48,3 +54,17 @@ func (h *HAL) WatchdogSet(timeout time.Duration) {
 func (h *HAL) WatchdogReset() {
 	machine.Watchdog.Update()
 }
+
+// UniqueID folds the chip's 64-bit unique board ID into 32 bits for identifying the decoder
+func (h *HAL) UniqueID() uint32 {
+	var id uint32
+	for i, b := range machine.DeviceID() {
+		id ^= uint32(b) << (8 * (i % 4))
+	}
+	return id
+}
+
+// Temperature reads the chip's internal temperature sensor in degrees Celsius
+func (h *HAL) Temperature() float32 {
+	return float32(machine.ReadTemperature()) / 1000
+}
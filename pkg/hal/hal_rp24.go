@@ -4,6 +4,12 @@ package hal
 
 import "machine"
 
+// DCC input timing profile in microseconds. The input smoothing capacitor delays one edge of each half-wave
+const (
+	dccEdgeDelay    = 6
+	dccBitTolerance = 0
+)
+
 func (h *HAL) Init() {
 	clear(h.pins)
 
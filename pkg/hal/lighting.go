@@ -0,0 +1,276 @@
+package hal
+
+import (
+	"math"
+	"time"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/cv"
+)
+
+// Effect is a lighting effect for an output. Conditional function rules select effects by the same numbers
+type Effect uint8
+
+const (
+	EffectOnOff Effect = iota
+	EffectDimmed
+	EffectFade
+	EffectMars
+	EffectGyralite
+	EffectStrobe
+	EffectDoubleStrobe
+	EffectBeacon
+	EffectDitchA
+	EffectDitchB
+	EffectFirebox
+	EffectFluorescent
+	numEffects
+)
+
+const (
+	// Lighting CVs, four per output from CV193 in output index order (lampFront, lampRear, aux1, ...)
+	// +0 effect, +1 brightness (0-255), +2 effect period in 10ms steps (0 = effect default), +3 fade time in 10ms steps
+	// (0 = 500ms)
+	lightingCVBase = 193
+	lightingCVs    = 4
+	// Level of the dimmed effect as a fraction of each output's brightness (0-255), shared by every output
+	lightingDimCV = 245
+
+	// How often the lighting effects are updated
+	lightingTick = 10 * time.Millisecond
+	// PWM frequency for the lighting outputs, high enough not to flicker on camera
+	lightingPWMFreq = 2 * shared.KHz
+
+	strobeFlash      = 40 * time.Millisecond
+	doubleStrobeGap  = 120 * time.Millisecond
+	fluorescentStart = 1200 * time.Millisecond
+	defaultFade      = 500 * time.Millisecond
+)
+
+// Default effect periods, used when the period CV is 0
+var effectPeriods = [numEffects]time.Duration{
+	EffectMars:         800 * time.Millisecond,
+	EffectGyralite:     1200 * time.Millisecond,
+	EffectStrobe:       1000 * time.Millisecond,
+	EffectDoubleStrobe: 1200 * time.Millisecond,
+	EffectBeacon:       1000 * time.Millisecond,
+	EffectDitchA:       800 * time.Millisecond,
+	EffectDitchB:       800 * time.Millisecond,
+	EffectFirebox:      100 * time.Millisecond,
+}
+
+type light struct {
+	pin shared.Pin
+	pwm *SimplePWM
+
+	// Configuration from the lighting CVs
+	effect     Effect
+	brightness float32
+	dim        float32
+	period     time.Duration
+	fade       time.Duration
+
+	// Effect selected by a function rule, which replaces the configured effect while it's set
+	selected Effect
+
+	on      bool
+	onSince time.Time
+	level   float32
+	flicker float32
+	random  uint32
+}
+
+// InitLight sets up the lighting effects for an output, index selects its block of lighting CVs
+func (h *HAL) InitLight(cvHandler cv.Handler, output string, index uint16) {
+	pin, ok := h.PinOk(output)
+	if !ok {
+		return
+	}
+	l := &light{pin: pin, brightness: 1, random: uint32(index) + 1}
+	pwm, err := h.InitPWM(pin, lightingPWMFreq, 0)
+	if err != nil {
+		// Without a PWM the output can still be switched, just without effects
+		println("could not set up lighting PWM for " + output + ": " + err.Error())
+	} else {
+		l.pwm = pwm
+	}
+	h.lightsMutex.Lock()
+	h.lights[output] = l
+	h.lightsMutex.Unlock()
+
+	base := lightingCVBase + index*lightingCVs
+	for cvNumber := base; cvNumber < base+lightingCVs; cvNumber++ {
+		cvHandler.RegisterCallback(cvNumber, func(cvNumber uint16, value uint8) bool {
+			h.lightsMutex.Lock()
+			defer h.lightsMutex.Unlock()
+			switch cvNumber - base {
+			case 0:
+				if Effect(value) >= numEffects {
+					return false
+				}
+				l.effect = Effect(value)
+			case 1:
+				l.brightness = float32(value) / 255
+			case 2:
+				l.period = time.Duration(value) * 10 * time.Millisecond
+			case 3:
+				l.fade = time.Duration(value) * 10 * time.Millisecond
+			}
+			h.updateLight(l, time.Now())
+			return true
+		})
+	}
+	cvHandler.RegisterCallback(lightingDimCV, func(_ uint16, value uint8) bool {
+		h.lightsMutex.Lock()
+		defer h.lightsMutex.Unlock()
+		l.dim = float32(value) / 255
+		h.updateLight(l, time.Now())
+		return true
+	})
+}
+
+// GetEffectCallback returns a function rule effect callback for an output
+func (h *HAL) GetEffectCallback(output string) func(uint16, uint8) {
+	return func(_ uint16, effect uint8) {
+		h.SetEffect(output, Effect(effect))
+	}
+}
+
+// SetEffect overrides an output's configured effect, EffectOnOff returns it to the configured effect
+func (h *HAL) SetEffect(output string, effect Effect) {
+	h.lightsMutex.Lock()
+	defer h.lightsMutex.Unlock()
+	l, ok := h.lights[output]
+	if !ok || effect >= numEffects {
+		return
+	}
+	l.selected = effect
+	h.updateLight(l, time.Now())
+}
+
+// RunLighting updates the lighting effects on a dedicated ticker
+func (h *HAL) RunLighting() {
+	ticker := time.NewTicker(lightingTick)
+	for now := range ticker.C {
+		h.updateLights(now)
+	}
+}
+
+func (h *HAL) updateLights(now time.Time) {
+	h.lightsMutex.Lock()
+	defer h.lightsMutex.Unlock()
+	for _, l := range h.lights {
+		h.updateLight(l, now)
+	}
+}
+
+// setLight switches an output, its effect then runs from the time it was switched on. Must be called with the
+// lights mutex held
+func (h *HAL) setLight(l *light, on bool, now time.Time) {
+	if on && !l.on {
+		l.onSince = now
+	}
+	l.on = on
+	h.updateLight(l, now)
+}
+
+// updateLight drives an output from its effect, outputs without a PWM are only switched on and off. Must be
+// called with the lights mutex held
+func (h *HAL) updateLight(l *light, now time.Time) {
+	if l.pwm == nil {
+		l.pin.Set(l.on)
+		return
+	}
+	effect := l.effect
+	if l.selected != EffectOnOff {
+		effect = l.selected
+	}
+
+	target := l.target(effect, now)
+	if effect == EffectFade {
+		// Ramp towards the target, taking the fade time to go from off to full brightness
+		fade := l.fade
+		if fade == 0 {
+			fade = defaultFade
+		}
+		step := float32(lightingTick) / float32(fade)
+		if target > l.level {
+			target = min(target, l.level+step)
+		} else {
+			target = max(target, l.level-step)
+		}
+	}
+	l.level = target
+	l.pwm.SetDuty(l.level)
+}
+
+// target returns the output level of an effect at a point in time
+func (l *light) target(effect Effect, now time.Time) float32 {
+	if !l.on {
+		return 0
+	}
+	b := l.brightness
+	since := now.Sub(l.onSince)
+	period := l.period
+	if period == 0 {
+		period = effectPeriods[effect]
+	}
+	var phase float64
+	if period > 0 {
+		phase = float64(since%period) / float64(period)
+	}
+
+	switch effect {
+	case EffectDimmed:
+		return b * l.dim
+	case EffectMars:
+		// A sweeping beam that peaks once per cycle and never quite goes dark
+		s := math.Sin(math.Pi * phase)
+		return b * float32(0.15+0.85*s*s*s*s)
+	case EffectGyralite:
+		// A wider, softer sweep than the Mars light
+		return b * float32(0.35+0.65*(0.5-0.5*math.Cos(2*math.Pi*phase)))
+	case EffectStrobe:
+		return flash(b, since%period < strobeFlash)
+	case EffectDoubleStrobe:
+		t := since % period
+		return flash(b, t < strobeFlash || t >= doubleStrobeGap && t < doubleStrobeGap+strobeFlash)
+	case EffectBeacon:
+		// A rotating reflector, bright as it passes with some spill light the rest of the way round
+		c := math.Cos(2 * math.Pi * phase)
+		return b * float32(0.1+0.9*max(0, c)*max(0, c))
+	case EffectDitchA:
+		return flash(b, phase < 0.5)
+	case EffectDitchB:
+		return flash(b, phase >= 0.5)
+	case EffectFirebox:
+		// Pick a new random level every period and glide towards it
+		if since%period < lightingTick {
+			l.flicker = 0.5 + 0.5*l.rand()
+		}
+		return 0.7*l.level + 0.3*b*l.flicker
+	case EffectFluorescent:
+		// A few random flickers before the tube strikes
+		if since < fluorescentStart {
+			return flash(b, l.rand() > 0.7)
+		}
+		return b
+	default:
+		return b
+	}
+}
+
+func flash(b float32, on bool) float32 {
+	if on {
+		return b
+	}
+	return 0
+}
+
+// rand returns a pseudo-random value from 0 to 1, a xorshift is plenty for flickering lights
+func (l *light) rand() float32 {
+	l.random ^= l.random << 13
+	l.random ^= l.random >> 17
+	l.random ^= l.random << 5
+	return float32(l.random&0xFFFF) / 0xFFFF
+}
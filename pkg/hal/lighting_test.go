@@ -0,0 +1,187 @@
+package hal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/cv"
+)
+
+// newTestLighting sets up lights for lampFront and lampRear on the mock HAL, returning the last PWM duty of each
+// output and how many PWMs were set up
+func newTestLighting(t *testing.T, cvs map[uint16]uint8) (*HAL, map[string]float32, *int) {
+	t.Helper()
+	t.Cleanup(func() {
+		PWMInitHook = nil
+		PWMSetDutyHook = nil
+	})
+
+	pins := map[shared.Pin]string{shared.MockPin(5): "lampFront", shared.MockPin(6): "lampRear"}
+	pwmOutput := make(map[*SimplePWM]string)
+	duties := make(map[string]float32)
+	inits := 0
+	PWMInitHook = func(pin shared.Pin, freq uint64, duty float32) (*SimplePWM, error) {
+		p := &SimplePWM{}
+		pwmOutput[p] = pins[pin]
+		inits++
+		return p, nil
+	}
+	PWMSetDutyHook = func(p *SimplePWM, duty float32) {
+		duties[pwmOutput[p]] = duty
+	}
+
+	h := NewHAL()
+	mockCV := cv.NewMockHandler(true, cvs)
+	for pin, output := range pins {
+		h.pins[output] = pin
+	}
+	h.InitLight(mockCV, "lampFront", 0)
+	h.InitLight(mockCV, "lampRear", 1)
+	return h, duties, &inits
+}
+
+func TestLightingEffects(t *testing.T) {
+	tests := []struct {
+		name   string
+		cvs    map[uint16]uint8
+		output string
+		// Expected duty at each offset from switching on
+		steps map[time.Duration]float32
+	}{
+		{
+			name:   "dimmed",
+			cvs:    map[uint16]uint8{193: uint8(EffectDimmed), 194: 204, 245: 64},
+			output: "lampFront",
+			steps:  map[time.Duration]float32{0: 0.2, time.Second: 0.2},
+		},
+		{
+			name:   "strobe",
+			cvs:    map[uint16]uint8{193: uint8(EffectStrobe), 194: 255},
+			output: "lampFront",
+			steps: map[time.Duration]float32{
+				10 * time.Millisecond:   1,
+				500 * time.Millisecond:  0,
+				1010 * time.Millisecond: 1,
+			},
+		},
+		{
+			name:   "double strobe",
+			cvs:    map[uint16]uint8{193: uint8(EffectDoubleStrobe), 194: 255},
+			output: "lampFront",
+			steps: map[time.Duration]float32{
+				10 * time.Millisecond:  1,
+				80 * time.Millisecond:  0,
+				130 * time.Millisecond: 1,
+				600 * time.Millisecond: 0,
+			},
+		},
+		{
+			name:   "ditch A with period",
+			cvs:    map[uint16]uint8{193: uint8(EffectDitchA), 194: 255, 195: 50},
+			output: "lampFront",
+			steps: map[time.Duration]float32{
+				100 * time.Millisecond: 1,
+				300 * time.Millisecond: 0,
+				600 * time.Millisecond: 1,
+			},
+		},
+		{
+			name:   "ditch B with period",
+			cvs:    map[uint16]uint8{197: uint8(EffectDitchB), 198: 255, 199: 50},
+			output: "lampRear",
+			steps: map[time.Duration]float32{
+				100 * time.Millisecond: 0,
+				300 * time.Millisecond: 1,
+				600 * time.Millisecond: 0,
+			},
+		},
+		{
+			name:   "fluorescent strikes",
+			cvs:    map[uint16]uint8{193: uint8(EffectFluorescent), 194: 255},
+			output: "lampFront",
+			steps:  map[time.Duration]float32{2 * time.Second: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, duties, _ := newTestLighting(t, tt.cvs)
+			start := time.Now()
+			h.setLight(h.lights[tt.output], true, start)
+			for offset, want := range tt.steps {
+				h.updateLights(start.Add(offset))
+				if got := duties[tt.output]; got < want-0.01 || got > want+0.01 {
+					t.Errorf("duty at %v = %v, want %v", offset, got, want)
+				}
+			}
+
+			h.setLight(h.lights[tt.output], false, start)
+			if got := duties[tt.output]; got != 0 {
+				t.Errorf("duty after switching off = %v, want 0", got)
+			}
+		})
+	}
+}
+
+func TestLightingFade(t *testing.T) {
+	// 100ms fade time, a tenth of full brightness per tick
+	h, duties, _ := newTestLighting(t, map[uint16]uint8{193: uint8(EffectFade), 194: 255, 196: 10})
+	l := h.lights["lampFront"]
+	now := time.Now()
+
+	h.setLight(l, true, now)
+	for i := 2; i <= 12; i++ {
+		now = now.Add(lightingTick)
+		h.updateLights(now)
+		want := min(float32(i)/10, 1)
+		if got := duties["lampFront"]; got < want-0.01 || got > want+0.01 {
+			t.Fatalf("duty after %d ticks fading in = %v, want %v", i, got, want)
+		}
+	}
+
+	h.setLight(l, false, now)
+	if got := duties["lampFront"]; got < 0.89 || got > 0.91 {
+		t.Errorf("duty on the first tick fading out = %v, want 0.9", got)
+	}
+}
+
+func TestLightingDimmed(t *testing.T) {
+	h, duties, _ := newTestLighting(t, map[uint16]uint8{193: 0, 194: 200, 245: 64})
+	h.SetOutput("lampFront", true)
+
+	// A rule selecting the dimmed effect lowers the output below its normal brightness
+	h.SetEffect("lampFront", EffectDimmed)
+	dimmed := duties["lampFront"]
+	h.SetEffect("lampFront", EffectOnOff)
+	full := duties["lampFront"]
+	if want := float32(200) / 255; full < want-0.01 || full > want+0.01 {
+		t.Errorf("full duty = %v, want %v", full, want)
+	}
+	if want := full * 64 / 255; dimmed < want-0.01 || dimmed > want+0.01 {
+		t.Errorf("dimmed duty = %v, want %v", dimmed, want)
+	}
+}
+
+func TestLightingOnOff(t *testing.T) {
+	h, duties, inits := newTestLighting(t, map[uint16]uint8{193: 0, 194: 128})
+
+	// Every output's PWM is set up once, whether or not it has an effect
+	if *inits != 2 {
+		t.Errorf("set up %d PWMs for two outputs, want 2", *inits)
+	}
+	h.SetOutput("lampFront", true)
+	if got, want := duties["lampFront"], float32(128)/255; got < want-0.01 || got > want+0.01 {
+		t.Errorf("plain on/off duty = %v, want %v", got, want)
+	}
+
+	// A rule selecting an effect drives the same PWM
+	h.SetEffect("lampFront", EffectStrobe)
+	if *inits != 2 {
+		t.Errorf("selecting an effect set up %d PWMs, want 2", *inits)
+	}
+	h.GetEffectCallback("lampFront")(0, uint8(numEffects))
+	if got := h.lights["lampFront"].selected; got != EffectStrobe {
+		t.Errorf("invalid effect selected %v, want %v", got, EffectStrobe)
+	}
+}
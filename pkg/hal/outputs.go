@@ -1,6 +1,10 @@
 package hal
 
-import "github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+import (
+	"time"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+)
 
 func (h *HAL) GetOutputCallback(output string) shared.OutputCallback {
 	return func(_ uint16, on bool) {
@@ -9,7 +13,12 @@ func (h *HAL) GetOutputCallback(output string) shared.OutputCallback {
 }
 
 func (h *HAL) SetOutput(output string, state bool) {
-	// TODO: Add support for dimming, strobing, etc.
+	h.lightsMutex.Lock()
+	defer h.lightsMutex.Unlock()
+	if l, ok := h.lights[output]; ok {
+		h.setLight(l, state, time.Now())
+		return
+	}
 	if pin, ok := h.pins[output]; ok {
 		pin.Set(state)
 	}
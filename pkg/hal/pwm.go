@@ -3,6 +3,7 @@
 package hal
 
 import (
+	"errors"
 	"machine"
 
 	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
@@ -35,12 +36,25 @@ func (s *SimplePWM) Slice() uint8 {
 
 var pwms = [...]pwm{machine.PWM0, machine.PWM1, machine.PWM2, machine.PWM3, machine.PWM4, machine.PWM5, machine.PWM6, machine.PWM7}
 
+// pwmSlice records the frequency a PWM slice was set up at and which of its channels are in use
+type pwmSlice struct {
+	freq     uint64
+	channels uint8
+}
+
 func (h *HAL) InitPWM(pin shared.Pin, freq uint64, duty float32) (*SimplePWM, error) {
 	slice, err := machine.PWMPeripheral(pin.(machine.Pin))
 	if err != nil {
 		return nil, err
 	}
 
+	// Pins on a slice share its frequency and pins on a channel share its duty (even pins are channel A, odd pins
+	// channel B), so don't take over a slice or channel that's already driving something else
+	bit := uint8(1) << (uint8(pin.(machine.Pin)) & 1)
+	if used, ok := h.pwms[slice]; ok && (used.freq != freq || used.channels&bit != 0) {
+		return nil, errors.New("PWM slice already in use")
+	}
+
 	pwm := pwms[slice]
 
 	channel, err := pwm.Channel(pin.(machine.Pin))
@@ -60,6 +74,8 @@ func (h *HAL) InitPWM(pin shared.Pin, freq uint64, duty float32) (*SimplePWM, er
 		top:     float32(pwm.Top()),
 	}
 
+	h.pwms[slice] = pwmSlice{freq: freq, channels: h.pwms[slice].channels | bit}
+
 	spwm.SetDuty(duty)
 	spwm.Enable(true)
 
@@ -1,7 +1,6 @@
 package motor
 
 import (
-	"fmt"
 	"sync"
 	"time"
 
@@ -185,6 +184,36 @@ func (m *Motor) SetSpeed(speed uint8, reverse bool) {
 	}
 }
 
+// Reset immediately stops the motor and returns the speed and direction state to its power-up defaults
+func (m *Motor) Reset() {
+	m.emergencyStop()
+	m.changeDirection = false
+	m.speedAfterStop = 0
+	if m.reverse {
+		m.reverse = false
+		m.setupADC(m.Direction())
+	}
+
+	// 28/128 speed mode selection is volatile, fall back to the speed mode configured in CV29
+	if m.cv[29]&0b00000010 == 0 {
+		m.SetSpeedMode(SpeedMode14)
+	} else {
+		m.SetSpeedMode(SpeedMode28)
+	}
+}
+
+// Stop brings the motor to a stop without changing direction, decelerating at the configured rate if momentum is
+// set, otherwise stopping immediately
+func (m *Motor) Stop(momentum bool) {
+	m.changeDirection = false
+	m.speedAfterStop = 0
+	if !momentum {
+		m.emergencyStop()
+		return
+	}
+	m.setTargetSpeed(0)
+}
+
 // stopMotor stops the motor
 func (m *Motor) stopMotor() {
 	m.ApplyPWM(0.0)
@@ -215,7 +244,6 @@ func (m *Motor) updateSpeedStep(elapsed time.Duration) {
 
 	// TODO: Handle going from 0 to non-zero speed after startup from dirty rail
 	if m.currentSpeed > m.targetSpeed && m.rawSpeed-m.targetRaw > 0.5 {
-		fmt.Printf("slow down - current: %d target: %d duty: %0.2f\r\n", m.currentSpeed, m.targetSpeed, m.speedTable[m.targetSpeed]) // TODO: Cleanup
 		if m.decelRate > 0 {
 			// decelRate: seconds per step * elapsed seconds = steps decreased
 			m.rawSpeed -= m.decelRate * float32(elapsed.Seconds())
@@ -224,7 +252,6 @@ func (m *Motor) updateSpeedStep(elapsed time.Duration) {
 			m.rawSpeed = m.targetRaw
 		}
 	} else if m.currentSpeed < m.targetSpeed && m.targetRaw-m.rawSpeed > 0.5 {
-		fmt.Printf("speed up - current: %d target: %d duty: %0.2f\r\n", m.currentSpeed, m.targetSpeed, m.speedTable[m.targetSpeed]) // TODO: Cleanup
 		if m.accelRate > 0 {
 			// accelRate: seconds per step * elapsed seconds = steps increased
 			m.rawSpeed += m.accelRate * float32(elapsed.Seconds())
@@ -237,6 +264,15 @@ func (m *Motor) updateSpeedStep(elapsed time.Duration) {
 	m.currentSpeed = uint8(m.rawSpeed + 0.5)
 }
 
+// ActualSpeed estimates the current speed as a 0-1 fraction of full speed. It's taken from the measured back-EMF
+// when speed control is active, otherwise from the speed table entry being driven
+func (m *Motor) ActualSpeed() float32 {
+	if !m.DisablePID && m.emfMax > 0 {
+		return min(1, max(0, m.emfValue/m.emfMax))
+	}
+	return m.speedTable[m.currentSpeed]
+}
+
 // Make sure we always set the target speed and raw speed together
 func (m *Motor) setTargetSpeed(speed uint8) {
 	m.targetSpeed = speed
@@ -249,3 +285,21 @@ func (m *Motor) Direction() Direction {
 	}
 	return Reverse
 }
+
+// TargetSpeed returns the commanded speed step the motor is accelerating or decelerating towards
+func (m *Motor) TargetSpeed() uint8 {
+	return m.targetSpeed
+}
+
+// Moving reports whether the motor is still being driven, it's stopped once it has slowed down to step 0
+func (m *Motor) Moving() bool {
+	return m.currentSpeed > 0
+}
+
+// TargetDirection returns the commanded direction, which only takes effect once the motor has stopped
+func (m *Motor) TargetDirection() Direction {
+	if m.reverse != m.changeDirection == m.ndotReverse {
+		return Forward
+	}
+	return Reverse
+}
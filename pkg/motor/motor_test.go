@@ -0,0 +1,72 @@
+package motor
+
+import (
+	"testing"
+
+	"github.com/mikesmitty/rp24-dcc-decoder/internal/shared"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/cv"
+	"github.com/mikesmitty/rp24-dcc-decoder/pkg/hal"
+)
+
+func TestReset(t *testing.T) {
+	defer func() {
+		hal.PWMSetDutyHook = nil
+	}()
+
+	var lastDuty float32
+	hal.PWMSetDutyHook = func(p *hal.SimplePWM, duty float32) {
+		lastDuty = duty
+	}
+
+	mockCV := cv.NewMockHandler(true, map[uint16]uint8{5: 255, 29: 0b00000010})
+	m := NewMotor(mockCV, hal.NewHAL(), shared.MockPin(1), shared.MockPin(2), shared.MockPin(3), shared.MockPin(4))
+	m.DisablePID = true
+	m.SetSpeedMode(SpeedMode128)
+	m.SetSpeed(60, false)
+	m.runMotorControl()
+	if m.currentSpeed != 60 {
+		t.Fatalf("currentSpeed = %d before reset, want 60", m.currentSpeed)
+	}
+	m.reverse = true
+	m.changeDirection = true
+	m.speedAfterStop = 20
+
+	m.Reset()
+
+	if m.currentSpeed != 0 || m.targetSpeed != 0 || m.rawSpeed != 0 {
+		t.Errorf("speed not cleared: current %d target %d raw %f", m.currentSpeed, m.targetSpeed, m.rawSpeed)
+	}
+	if lastDuty != 0 {
+		t.Errorf("duty = %f after reset, want 0", lastDuty)
+	}
+	if m.Direction() != Forward || m.changeDirection || m.speedAfterStop != 0 {
+		t.Errorf("direction state not cleared: direction %v changeDirection %t speedAfterStop %d", m.Direction(), m.changeDirection, m.speedAfterStop)
+	}
+	if m.SpeedMode() != SpeedMode28 {
+		t.Errorf("speed mode = %d after reset, want %d from CV29", m.SpeedMode(), SpeedMode28)
+	}
+}
+
+func TestActualSpeed(t *testing.T) {
+	mockCV := cv.NewMockHandler(true, map[uint16]uint8{29: 0b00000010})
+	m := NewMotor(mockCV, hal.NewHAL(), shared.MockPin(1), shared.MockPin(2), shared.MockPin(3), shared.MockPin(4))
+
+	// Without back-EMF the speed table entry being driven is the best guess
+	m.DisablePID = true
+	m.currentSpeed = 10
+	m.speedTable[10] = 0.25
+	if got := m.ActualSpeed(); got != 0.25 {
+		t.Errorf("ActualSpeed() = %f from the speed table, want 0.25", got)
+	}
+
+	m.DisablePID = false
+	m.emfMax = 1000
+	m.emfValue = 600
+	if got := m.ActualSpeed(); got != 0.6 {
+		t.Errorf("ActualSpeed() = %f from back-EMF, want 0.6", got)
+	}
+	m.emfValue = 1500
+	if got := m.ActualSpeed(); got != 1 {
+		t.Errorf("ActualSpeed() = %f above emfMax, want 1", got)
+	}
+}
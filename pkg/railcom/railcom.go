@@ -0,0 +1,148 @@
+// Package railcom builds RailCom (RCN-217) datagrams for sending in the cutout after a DCC packet. Every
+// 6 bits of a datagram are sent as one 4/8 coded byte, with 4 ones and 4 zeros in each byte
+package railcom
+
+// Channel capacity in coded bytes
+const (
+	Channel1Size = 2
+	Channel2Size = 6
+)
+
+// Datagram IDs
+const (
+	IDPOM     uint8 = 0
+	IDAdrHigh uint8 = 1
+	IDAdrLow  uint8 = 2
+	IDExt     uint8 = 3
+	IDDyn     uint8 = 7
+	IDXPOM    uint8 = 8 // IDs 8-11 are the XPOM sequence numbers 0-3
+)
+
+// Datagram lengths in bits, including the 4-bit ID
+const (
+	Datagram12 = 12
+	Datagram18 = 18
+	Datagram24 = 24
+	Datagram36 = 36
+)
+
+// Special codes sent in place of a datagram
+const (
+	ACK  byte = 0b00001111
+	NACK byte = 0b00111100
+	BUSY byte = 0b11100001
+)
+
+// AddressKind selects how an address is reported in app:adr_high/app:adr_low
+type AddressKind uint8
+
+const (
+	ShortAddress AddressKind = iota
+	LongAddress
+	ConsistAddress
+)
+
+// 4/8 code for each 6-bit value, from NMRA S-9.3.2
+var codes = [64]byte{
+	0x00: 0b10101100, 0x01: 0b10101010, 0x02: 0b10101001, 0x03: 0b10100101,
+	0x04: 0b10100011, 0x05: 0b10100110, 0x06: 0b10011100, 0x07: 0b10011010,
+	0x08: 0b10011001, 0x09: 0b10010101, 0x0A: 0b10010011, 0x0B: 0b10010110,
+	0x0C: 0b10001110, 0x0D: 0b10001101, 0x0E: 0b10001011, 0x0F: 0b10110001,
+	0x10: 0b10110010, 0x11: 0b10110100, 0x12: 0b10111000, 0x13: 0b01110100,
+	0x14: 0b01110010, 0x15: 0b01101100, 0x16: 0b01101010, 0x17: 0b01101001,
+	0x18: 0b01100101, 0x19: 0b01100011, 0x1A: 0b01100110, 0x1B: 0b01011100,
+	0x1C: 0b01011010, 0x1D: 0b01011001, 0x1E: 0b01010101, 0x1F: 0b01010011,
+	0x20: 0b01010110, 0x21: 0b01001110, 0x22: 0b01001101, 0x23: 0b01001011,
+	0x24: 0b01000111, 0x25: 0b01110001, 0x26: 0b11101000, 0x27: 0b11100100,
+	0x28: 0b11100010, 0x29: 0b11010001, 0x2A: 0b11001001, 0x2B: 0b11000101,
+	0x2C: 0b11011000, 0x2D: 0b11010100, 0x2E: 0b11010010, 0x2F: 0b11001010,
+	0x30: 0b11000110, 0x31: 0b11001100, 0x32: 0b01111000, 0x33: 0b00010111,
+	0x34: 0b00011011, 0x35: 0b00011101, 0x36: 0b00011110, 0x37: 0b00101110,
+	0x38: 0b00110110, 0x39: 0b00111010, 0x3A: 0b00100111, 0x3B: 0b00101011,
+	0x3C: 0b00101101, 0x3D: 0b00110101, 0x3E: 0b00111001, 0x3F: 0b00110011,
+}
+
+// Decode returns the 6-bit value of a 4/8 coded byte, ok is false for special codes and invalid bytes
+func Decode(b byte) (uint8, bool) {
+	for v, code := range codes {
+		if code == b {
+			return uint8(v), true
+		}
+	}
+	return 0, false
+}
+
+// encode appends the 4/8 coding of the low bits of value, MSB first. bits must be a multiple of 6
+func encode(dst []byte, value uint64, bits int) []byte {
+	for shift := bits - 6; shift >= 0; shift -= 6 {
+		dst = append(dst, codes[value>>shift&0x3F])
+	}
+	return dst
+}
+
+// Datagram appends a datagram with a 4-bit ID followed by size-4 bits of data. Sizes other than 12, 18, 24
+// or 36 bits are ignored
+func Datagram(dst []byte, id uint8, data uint32, size int) []byte {
+	switch size {
+	case Datagram12, Datagram18, Datagram24, Datagram36:
+	default:
+		return dst
+	}
+	bits := size - 4
+	value := uint64(id&0x0F)<<bits | uint64(data)&(1<<bits-1)
+	return encode(dst, value, size)
+}
+
+// Raw48 appends 48 bits of data without an ID, DCC-A replies use channel 1 and 2 as a single 8 byte block
+func Raw48(dst []byte, b [6]byte) []byte {
+	var value uint64
+	for _, v := range b {
+		value = value<<8 | uint64(v)
+	}
+	return encode(dst, value, 48)
+}
+
+// AddressHigh appends the app:adr_high datagram for a decoder address
+func AddressHigh(dst []byte, addr uint16, kind AddressKind) []byte {
+	var high uint8
+	switch kind {
+	case LongAddress:
+		high = 0x80 | uint8(addr>>8)&0x3F
+	case ConsistAddress:
+		high = 0x60
+	}
+	return Datagram(dst, IDAdrHigh, uint32(high), Datagram12)
+}
+
+// AddressLow appends the app:adr_low datagram for a decoder address
+func AddressLow(dst []byte, addr uint16, kind AddressKind) []byte {
+	low := uint8(addr)
+	if kind != LongAddress {
+		low &= 0x7F
+	}
+	return Datagram(dst, IDAdrLow, uint32(low), Datagram12)
+}
+
+// POM appends the app:pom datagram answering a CV read or write in operations mode
+func POM(dst []byte, value uint8) []byte {
+	return Datagram(dst, IDPOM, uint32(value), Datagram12)
+}
+
+// XPOM appends the app:pom datagram answering an XPOM read with 4 CV values, seq is the sequence number
+// (0-3) of the XPOM instruction
+func XPOM(dst []byte, seq uint8, values [4]byte) []byte {
+	data := uint32(values[0])<<24 | uint32(values[1])<<16 | uint32(values[2])<<8 | uint32(values[3])
+	return Datagram(dst, IDXPOM+seq&0b11, data, Datagram36)
+}
+
+// Ext appends the app:ext location information datagram, with a 6-bit type and an 8-bit position
+// TTTTTT PPPPPPPP
+func Ext(dst []byte, typ, position uint8) []byte {
+	return Datagram(dst, IDExt, uint32(typ&0x3F)<<8|uint32(position), Datagram18)
+}
+
+// Dyn appends the app:dyn dynamic variable datagram, with an 8-bit value and a 6-bit variable index
+// DDDDDDDD XXXXXX
+func Dyn(dst []byte, index, value uint8) []byte {
+	return Datagram(dst, IDDyn, uint32(value)<<6|uint32(index&0x3F), Datagram18)
+}
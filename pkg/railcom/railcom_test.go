@@ -0,0 +1,196 @@
+package railcom
+
+import (
+	"bytes"
+	"math/bits"
+	"testing"
+)
+
+func TestCodes(t *testing.T) {
+	seen := make(map[byte]bool)
+	for v, code := range codes {
+		if bits.OnesCount8(code) != 4 {
+			t.Errorf("code for %#02x = %08b, want 4 ones", v, code)
+		}
+		if seen[code] {
+			t.Errorf("code for %#02x = %08b is not unique", v, code)
+		}
+		seen[code] = true
+
+		got, ok := Decode(code)
+		if !ok || int(got) != v {
+			t.Errorf("Decode(%08b) = %#02x, %t, want %#02x", code, got, ok, v)
+		}
+	}
+
+	for _, special := range []byte{ACK, NACK, BUSY} {
+		if seen[special] {
+			t.Errorf("special code %08b is also a data code", special)
+		}
+		if _, ok := Decode(special); ok {
+			t.Errorf("Decode(%08b) ok, want special code to be rejected", special)
+		}
+	}
+}
+
+// decodeAll turns coded bytes back into a single value
+func decodeAll(t *testing.T, b []byte) uint64 {
+	t.Helper()
+	var value uint64
+	for _, code := range b {
+		v, ok := Decode(code)
+		if !ok {
+			t.Fatalf("invalid code %08b", code)
+		}
+		value = value<<6 | uint64(v)
+	}
+	return value
+}
+
+func TestDatagram(t *testing.T) {
+	tests := []struct {
+		name   string
+		got    []byte
+		length int
+		expect uint64
+	}{
+		{
+			name:   "12-bit",
+			got:    Datagram(nil, 0x5, 0xA7, Datagram12),
+			length: 2,
+			expect: 0x5A7,
+		},
+		{
+			name:   "18-bit",
+			got:    Datagram(nil, 0x3, 0x3FFF, Datagram18),
+			length: 3,
+			expect: 0x3<<14 | 0x3FFF,
+		},
+		{
+			name:   "24-bit",
+			got:    Datagram(nil, 0xC, 0xABCDE, Datagram24),
+			length: 4,
+			expect: 0xCABCDE,
+		},
+		{
+			name:   "36-bit",
+			got:    Datagram(nil, 0x9, 0xDEADBEEF, Datagram36),
+			length: 6,
+			expect: 0x9DEADBEEF,
+		},
+		{
+			name:   "Data is truncated to fit",
+			got:    Datagram(nil, 0x1, 0x1FF, Datagram12),
+			length: 2,
+			expect: 0x1FF,
+		},
+		{
+			name:   "Invalid size",
+			got:    Datagram(nil, 0x1, 0, 30),
+			length: 0,
+		},
+		{
+			name:   "DCC-A block",
+			got:    Raw48(nil, [6]byte{0xF0, 0x0D, 0x12, 0x34, 0x56, 0x78}),
+			length: 8,
+			expect: 0xF00D12345678,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.got) != tt.length {
+				t.Fatalf("length = %d, want %d", len(tt.got), tt.length)
+			}
+			if got := decodeAll(t, tt.got); got != tt.expect {
+				t.Errorf("value = %#x, want %#x", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestApplications(t *testing.T) {
+	tests := []struct {
+		name   string
+		got    []byte
+		expect uint64
+	}{
+		{
+			name:   "app:adr_high short address",
+			got:    AddressHigh(nil, 3, ShortAddress),
+			expect: 0x100,
+		},
+		{
+			name:   "app:adr_low short address",
+			got:    AddressLow(nil, 3, ShortAddress),
+			expect: 0x203,
+		},
+		{
+			name:   "app:adr_high long address",
+			got:    AddressHigh(nil, 1234, LongAddress),
+			expect: 0x184,
+		},
+		{
+			name:   "app:adr_low long address",
+			got:    AddressLow(nil, 1234, LongAddress),
+			expect: 0x2D2,
+		},
+		{
+			name:   "app:adr_high consist address",
+			got:    AddressHigh(nil, 100, ConsistAddress),
+			expect: 0x160,
+		},
+		{
+			name:   "app:adr_low consist address",
+			got:    AddressLow(nil, 100, ConsistAddress),
+			expect: 0x264,
+		},
+		{
+			name:   "app:pom",
+			got:    POM(nil, 0x42),
+			expect: 0x042,
+		},
+		{
+			name:   "app:pom XPOM",
+			got:    XPOM(nil, 2, [4]byte{1, 2, 3, 4}),
+			expect: 0xA01020304,
+		},
+		{
+			name:   "app:ext",
+			got:    Ext(nil, 0x21, 0x80),
+			expect: 0x3<<14 | 0x21<<8 | 0x80,
+		},
+		{
+			name:   "app:dyn",
+			got:    Dyn(nil, 7, 200),
+			expect: 0x7<<14 | 200<<6 | 7,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeAll(t, tt.got); got != tt.expect {
+				t.Errorf("value = %#x, want %#x", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestChannels(t *testing.T) {
+	// Channel 1 carries one address datagram, channel 2 can combine datagrams and special codes
+	ch1 := AddressHigh(make([]byte, 0, Channel1Size), 3, ShortAddress)
+	if len(ch1) != Channel1Size {
+		t.Errorf("channel 1 length = %d, want %d", len(ch1), Channel1Size)
+	}
+
+	ch2 := make([]byte, 0, Channel2Size)
+	ch2 = POM(ch2, 0x42)
+	ch2 = Dyn(ch2, 0, 10)
+	ch2 = append(ch2, ACK)
+	if len(ch2) != Channel2Size {
+		t.Fatalf("channel 2 length = %d, want %d", len(ch2), Channel2Size)
+	}
+	if !bytes.Equal(ch2[:2], POM(nil, 0x42)) || ch2[5] != ACK {
+		t.Errorf("channel 2 = % x, want app:pom, app:dyn then ACK", ch2)
+	}
+}
@@ -66,7 +66,7 @@ func (s *Store) recoverableMountError(err error) bool {
 
 // persist immediately writes a CV value to onboard flash
 func (s *Store) persist(index, cvNumber uint16, value uint8) bool {
-	if cvNumber < 1 || cvNumber > 256 {
+	if slot(index, cvNumber) == 0 {
 		println("CV number out of range")
 		return false
 	}
@@ -78,7 +78,7 @@ func (s *Store) persist(index, cvNumber uint16, value uint8) bool {
 		println("could not open file: " + err.Error())
 		return false
 	}
-	_, err = f.Seek(int64(cvNumber-1), io.SeekStart)
+	_, err = f.Seek(fileOffset(cvNumber), io.SeekStart)
 	if err != nil {
 		println("could not seek file: " + err.Error())
 		return false
@@ -124,7 +124,7 @@ func (s *Store) ReadCVsFromFlash(index, startCV, count uint16) ([]uint8, bool) {
 
 	// Read the CVs from the index
 	buf := make([]byte, count)
-	_, err = f.Seek(int64(startCV-1), io.SeekStart)
+	_, err = f.Seek(fileOffset(startCV), io.SeekStart)
 	if err != nil {
 		println("could not seek file: " + err.Error())
 		return nil, false
@@ -138,7 +138,7 @@ func (s *Store) ReadCVsFromFlash(index, startCV, count uint16) ([]uint8, bool) {
 	return buf, true
 }
 
-// LoadIndex loads a persistent CV index from flash
+// LoadIndex loads the persistent CVs of an index page from flash
 // Bool return value indicates if the index file was found
 func (s *Store) LoadIndex(newIndex uint16) (bool, error) {
 	newIndexFile := indexFileName(newIndex)
@@ -154,17 +154,19 @@ func (s *Store) LoadIndex(newIndex uint16) (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	defer f.Close()
 
 	// If the file already exists, load the CVs we have been informed of by SetDefault()
 	if ok {
 		buf := []byte{0}
-		for cvNumber, data := range s.data {
-			if cvNumber < 1 {
+		for key, data := range s.data {
+			index, cvNumber := page(key)
+			if cvNumber < 1 || index != newIndex {
 				continue
 			}
 			if (data.Flags & Persistent) != 0 {
 				// Read the CV from flash
-				_, err = f.Seek(int64(cvNumber-1), io.SeekStart)
+				_, err = f.Seek(fileOffset(cvNumber), io.SeekStart)
 				if err != nil {
 					println("could not seek file: " + err.Error())
 					return false, nil
@@ -174,11 +176,13 @@ func (s *Store) LoadIndex(newIndex uint16) (bool, error) {
 					println("could not read from file: " + err.Error())
 					return false, nil
 				}
+				data.Value = buf[0]
+				s.data[key] = data
 			}
 		}
 	} else {
-		// If the file is new, pad it out to 256 bytes
-		_, err := f.Write(make([]byte, 256))
+		// If the file is new, pad it out to a full page
+		_, err := f.Write(make([]byte, pageSize))
 		if err != nil {
 			return false, err
 		}
@@ -188,48 +192,76 @@ func (s *Store) LoadIndex(newIndex uint16) (bool, error) {
 		}
 	}
 
-	// After successfully loading the index, set the index and index file
-	s.index = newIndex
-	s.indexFile = indexFileName(newIndex)
-
 	return ok, nil
 }
 
+// fileOffset returns the position of a CV in its index file, each file holds one page of 256 CVs
+func fileOffset(cvNumber uint16) int64 {
+	return int64((cvNumber - 1) % pageSize)
+}
+
 // indexFileName returns the filename for the given index file
 func indexFileName(index uint16) string {
 	return "cvstore/index" + strconv.FormatUint(uint64(index), 10) + ".bin"
 }
 
-// ProcessChanges iterates through the current CV index and persists any dirty CVs
+// ProcessChanges persists any dirty CVs to the files of their index pages
 func (s *Store) ProcessChanges() bool {
-	f, err := s.fs.OpenFile(s.indexFile, os.O_WRONLY)
+	// Group the changed CVs by index page so each file is only opened once
+	changes := make(map[uint16][]uint16)
+	for key, data := range s.data {
+		if (data.Flags&Dirty) != 0 && (data.Flags&Persistent) != 0 {
+			index, _ := page(key)
+			changes[index] = append(changes[index], key)
+		}
+	}
+
+	for index, keys := range changes {
+		if !s.writeChanges(index, keys) {
+			return false
+		}
+	}
+
+	// Now that the files are saved clear the dirty flags
+	for key, data := range s.data {
+		if (data.Flags & Dirty) != 0 {
+			// Clear the dirty flag
+			data.Flags &^= Dirty // Use bitwise AND NOT to clear the flag
+			s.data[key] = data   // Store back into the map
+		}
+	}
+
+	return true
+}
+
+// writeChanges writes the changed CVs of one index page to its file
+func (s *Store) writeChanges(index uint16, keys []uint16) bool {
+	indexFile := indexFileName(index)
+	f, err := s.fs.OpenFile(indexFile, os.O_WRONLY)
 	if err != nil {
 		println("could not open file: " + err.Error())
 		return false
 	}
 
 	// Write all the changed CVs to flash
-	for cvNumber, data := range s.data {
-		if (data.Flags & Dirty) != 0 {
-			if (data.Flags & Persistent) != 0 {
-				_, err = f.Seek(int64(cvNumber-1), io.SeekStart)
-				if err != nil {
-					println("could not seek file: " + err.Error())
-					return false
-				}
-				_, err = f.Write([]byte{data.Value})
-				if err != nil {
-					println("could not write to file: " + err.Error())
-					return false
-				}
-			}
+	for _, key := range keys {
+		_, cvNumber := page(key)
+		_, err = f.Seek(fileOffset(cvNumber), io.SeekStart)
+		if err != nil {
+			println("could not seek file: " + err.Error())
+			return false
+		}
+		_, err = f.Write([]byte{s.data[key].Value})
+		if err != nil {
+			println("could not write to file: " + err.Error())
+			return false
 		}
 	}
 
 	// Sync and close the file
 	err = f.(*littlefs.File).Sync()
 	if err != nil {
-		println("could not sync writes to '", s.indexFile, "': "+err.Error())
+		println("could not sync writes to '", indexFile, "': "+err.Error())
 		return false
 	}
 	err = f.Close()
@@ -237,15 +269,5 @@ func (s *Store) ProcessChanges() bool {
 		println("could not close file: " + err.Error())
 		return false
 	}
-
-	// Now that the file is saved clear the dirty flags
-	for cvNumber, data := range s.data {
-		if (data.Flags & Dirty) != 0 {
-			// Clear the dirty flag
-			data.Flags &^= Dirty    // Use bitwise AND NOT to clear the flag
-			s.data[cvNumber] = data // Store back into the map
-		}
-	}
-
 	return true
 }
@@ -17,6 +17,10 @@ const (
 	Persistent                     // CV should be saved to non-volatile memory
 )
 
+// Index page 0 holds CVs 1-256 and every page above it holds its own set of CVs 257-512. All the pages are
+// kept in memory, CVs 257-512 are looked up in the page selected by index (CV31/32)
+const pageSize = 256
+
 // Data holds the value, default, and flags for a single CV
 type Data struct {
 	Value   uint8
@@ -28,11 +32,10 @@ type Store struct {
 	// Store is our map of CV number to CVData
 	async bool
 	// uint16 because 64kV ought to be enough for anybody
-	data      map[uint16]Data
-	fs        tinyfs.Filesystem
-	index     uint16
-	indexFile string
-	ticker    *time.Ticker
+	data   map[uint16]Data
+	fs     tinyfs.Filesystem
+	index  uint16
+	ticker *time.Ticker
 }
 
 // NewStore sets up the CV store and mounts the filesystem
@@ -63,9 +66,44 @@ func (s *Store) Run() {
 	}
 }
 
+// slot returns the data map key for a CV in an index page, or 0 if the page can't hold the CV
+func slot(index, cvNumber uint16) uint16 {
+	switch {
+	case cvNumber <= pageSize:
+		return cvNumber
+	case index == 0 || cvNumber > 2*pageSize:
+		return 0
+	default:
+		return cvNumber + (index-1)*pageSize
+	}
+}
+
+// page returns the index page and CV number stored under a data map key
+func page(key uint16) (uint16, uint16) {
+	if key <= pageSize {
+		return 0, key
+	}
+	index := (key - 1) / pageSize
+	return index, key - (index-1)*pageSize
+}
+
+// SetIndex selects the index page used for CVs 257-512
+func (s *Store) SetIndex(index uint16) {
+	s.index = index
+}
+
 // SetDefault sets the value, default value and flags for a CV
 func (s *Store) SetDefault(cvNumber uint16, defaultValue uint8, flags CVFlags) {
-	s.data[cvNumber] = Data{
+	s.IndexedSetDefault(s.index, cvNumber, defaultValue, flags)
+}
+
+// IndexedSetDefault sets the value, default value and flags for a CV in the provided index page
+func (s *Store) IndexedSetDefault(index, cvNumber uint16, defaultValue uint8, flags CVFlags) {
+	key := slot(index, cvNumber)
+	if key == 0 {
+		return
+	}
+	s.data[key] = Data{
 		Value:   defaultValue,
 		Default: defaultValue,
 		Flags:   flags,
@@ -74,77 +112,89 @@ func (s *Store) SetDefault(cvNumber uint16, defaultValue uint8, flags CVFlags) {
 
 // SetReadOnly sets a CV to read-only
 func (s *Store) SetReadOnly(cvNumber uint16) {
-	data, ok := s.data[cvNumber]
+	key := slot(s.index, cvNumber)
+	data, ok := s.data[key]
 	if !ok {
 		return // CV not found or unused
 	}
 	data.Flags |= ReadOnly
-	s.data[cvNumber] = data
+	s.data[key] = data
 }
 
 // CV retrieves the value of a CV
 func (s *Store) CV(cvNumber uint16) (uint8, bool) {
-	data, ok := s.data[cvNumber]
-	if !ok {
-		return 0, false // CV not found or unused
-	}
-	return data.Value, true
+	return s.IndexedCV(s.index, cvNumber)
 }
 
 // IndexedCV retrieves the value of a CV using the provided index
-// Does not check whether or not the CV is valid, only if the read succeeded
 func (s *Store) IndexedCV(index, cvNumber uint16) (uint8, bool) {
-	if index == s.index {
-		return s.CV(cvNumber)
+	data, ok := s.data[slot(index, cvNumber)]
+	if !ok {
+		return 0, false // CV not found or unused
 	}
-	return s.ReadCVFromFlash(index, cvNumber)
+	return data.Value, true
 }
 
 // Set sets the value of a CV, marking it as dirty if it's not read-only
 func (s *Store) Set(cvNumber uint16, value uint8) bool {
-	data, ok := s.data[cvNumber]
+	return s.IndexedSet(s.index, cvNumber, value)
+}
+
+// IndexedSet sets the value of a CV in the provided index page, marking it as dirty if it's not read-only
+func (s *Store) IndexedSet(index, cvNumber uint16, value uint8) bool {
+	key := slot(index, cvNumber)
+	if key == 0 {
+		return false // The page can't hold this CV
+	}
+	data, ok := s.data[key]
 	if (data.Flags & ReadOnly) != 0 {
 		return false // CV is read-only
 	}
 	if !ok || data.Value != value { // Only update if the value is different or key is missing
 		data.Value = value
-		data.Flags |= Dirty     // Mark as dirty
-		s.data[cvNumber] = data // Store back into the map
+		data.Flags |= Dirty // Mark as dirty
+		s.data[key] = data  // Store back into the map
 	}
 
 	// If we're not running async, persist the change immediately
 	if !s.async && (data.Flags&Dirty) != 0 && (data.Flags&Persistent) != 0 {
-		return s.persist(s.index, cvNumber, value)
+		return s.persist(index, cvNumber, value)
 	}
 	return true
 }
 
 // Reset resets a single CV to its default value
 func (s *Store) Reset(cvNumber uint16) bool {
-	data, ok := s.data[cvNumber]
+	return s.IndexedReset(s.index, cvNumber)
+}
+
+// IndexedReset resets a single CV in the provided index page to its default value
+func (s *Store) IndexedReset(index, cvNumber uint16) bool {
+	key := slot(index, cvNumber)
+	data, ok := s.data[key]
 	if !ok {
 		return false // CV not found or unused
 	}
 	if data.Value != data.Default { // Only update and mark dirty if needed
 		data.Value = data.Default
 		data.Flags |= Dirty
-		s.data[cvNumber] = data
+		s.data[key] = data
 		// If we're not running async, persist the change immediately
 		if !s.async {
-			return s.persist(s.index, cvNumber, data.Value)
+			return s.persist(index, cvNumber, data.Value)
 		}
 	}
 	return true
 }
 
-// ResetAllCVs resets all used CVs to their default values
+// ResetAllCVs resets all used CVs in every index page to their default values
 func (s *Store) ResetAll() {
-	for cvNumber := range s.data {
-		s.Reset(cvNumber)
+	for key := range s.data {
+		s.IndexedReset(page(key))
 	}
 }
 
-// Clear empties the CV store in preparation for loading a new index
+// Clear empties the CV store in preparation for loading the defaults
 func (s *Store) Clear() {
 	clear(s.data)
 }
@@ -100,3 +100,46 @@ func TestProcessChanges(t *testing.T) {
 		t.Errorf("CV 2: Dirty flag should be cleared")
 	}
 }
+
+func TestIndexPages(t *testing.T) {
+	cvTable := NewStore()
+	cvTable.SetDefault(29, 2, Volatile)
+	for index := uint16(1); index <= 2; index++ {
+		cvTable.IndexedSetDefault(index, 257, 0, Volatile)
+	}
+
+	cvTable.SetIndex(1)
+	if !cvTable.Set(257, 10) {
+		t.Fatalf("Failed to set CV 257 in index 1")
+	}
+	cvTable.SetIndex(2)
+	if !cvTable.Set(257, 20) {
+		t.Fatalf("Failed to set CV 257 in index 2")
+	}
+
+	tests := []struct {
+		index    uint16
+		cvNumber uint16
+		value    uint8
+		ok       bool
+	}{
+		{0, 29, 2, true},
+		{1, 29, 2, true},
+		{2, 29, 2, true},
+		{0, 257, 0, false},
+		{1, 257, 10, true},
+		{2, 257, 20, true},
+		{1, 258, 0, false},
+	}
+	for _, tt := range tests {
+		value, ok := cvTable.IndexedCV(tt.index, tt.cvNumber)
+		if ok != tt.ok || value != tt.value {
+			t.Errorf("index %d CV %d: got %d, %v, want %d, %v", tt.index, tt.cvNumber, value, ok, tt.value, tt.ok)
+		}
+	}
+
+	cvTable.ResetAll()
+	if value, _ := cvTable.IndexedCV(1, 257); value != 0 {
+		t.Errorf("index 1 CV 257: expected 0 after reset, got %d", value)
+	}
+}